@@ -0,0 +1,329 @@
+// Command proteus scans Go packages and inspects the schema generated from
+// their types.
+//
+// Usage:
+//
+//	proteus proto [-config file] -out dir [-go] [paths...]
+//	proteus graph [-config file] [-format dot|mermaid] [-type name] [paths...]
+//
+// All the commands accept the following flags to choose how diagnostics
+// are reported:
+//
+//	-diagnostics text|json|sarif
+//		format of the diagnostics: colored text, a JSON object per line
+//		or a SARIF log, which is written once the command finishes.
+//	-diagnostics-output file
+//		file where the diagnostics are written instead of the standard
+//		error output.
+//	-strict
+//		turn all warnings into errors, unless the severity of their
+//		code is overridden in the configuration.
+//
+// Any error reported makes the command fail. Diagnostics about a field or
+// type can be suppressed with a `//proteus:ignore <code>...` comment on it.
+//
+// The proto command writes the .proto files of the scanned packages in the
+// given directory, each one in the directory of the import path of its
+// package. Packages opted in with a `//proteus:service` comment on their
+// package clause get a service with an RPC per exported function, and
+// types opted in with the same comment get a service with an RPC per
+// exported method. With -go, the Go code serving those services with the
+// original functions and methods is also written, along with clients whose
+// methods have the signatures of those functions and methods. They are
+// written in the directory of the Go package of every .proto file, where
+// protoc writes the code generated for it when its output directory is the
+// same.
+//
+// The graph command prints the dependency graph of the messages and enums
+// of the scanned packages. With -type, only the given type and the types
+// that pull it into the schema are printed. Import cycles between the
+// packages are reported and make the command fail.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/src-d/proteus"
+	"github.com/src-d/proteus/gogen"
+	"github.com/src-d/proteus/protobuf"
+	"github.com/src-d/proteus/report"
+	"github.com/src-d/proteus/resolver"
+	"github.com/src-d/proteus/scanner"
+)
+
+const usage = `usage: proteus <command> [arguments]
+
+commands:
+	proto	generate the .proto files of the scanned packages
+	graph	print the dependency graph of the scanned types
+`
+
+// reporter receives all the diagnostics. The standard output is reserved
+// to the output of the commands.
+var reporter report.Reporter = report.NewConsole(os.Stderr)
+
+var (
+	// closers are closed once the command finishes to flush the
+	// diagnostics.
+	closers []io.Closer
+	// enforcer applies the severity policy of the configuration and
+	// counts the errors, which make the command fail.
+	enforcer *report.Enforcer
+	// suppressions drops the suppressed diagnostics and reports the
+	// unused suppressions once the command finishes.
+	suppressions *report.SuppressionFilter
+	// strict is true if all warnings are turned into errors.
+	strict bool
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "proto":
+		err = proto(os.Args[2:])
+	case "graph":
+		err = graph(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		reportError(err)
+	} else if suppressions != nil {
+		suppressions.ReportUnused()
+	}
+
+	for _, c := range closers {
+		if cerr := c.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "unable to write diagnostics: %s\n", cerr)
+			os.Exit(1)
+		}
+	}
+
+	if err != nil || (enforcer != nil && enforcer.Errors() > 0) {
+		os.Exit(1)
+	}
+}
+
+// diagnosticsFlags adds the flags to configure the reporting of the
+// diagnostics to the given flag set. The returned function must be called
+// after parsing the flags to set up the reporter accordingly.
+func diagnosticsFlags(flags *flag.FlagSet) func() error {
+	format := flags.String("diagnostics", "text", "format of the diagnostics: text, json or sarif")
+	output := flags.String("diagnostics-output", "", "file where the diagnostics are written instead of stderr")
+	flags.BoolVar(&strict, "strict", false, "turn all warnings into errors")
+
+	return func() error {
+		var w io.Writer = os.Stderr
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			w = f
+			defer func() { closers = append(closers, f) }()
+		}
+
+		switch *format {
+		case "text":
+			reporter = report.NewConsole(w)
+		case "json":
+			j := report.NewJSON(w)
+			reporter = j
+			closers = append(closers, errCloser(j.Err))
+		case "sarif":
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			s := report.NewSARIF(w, root)
+			reporter = s
+			closers = append(closers, s)
+		default:
+			return fmt.Errorf("unknown diagnostics format %q", *format)
+		}
+
+		return nil
+	}
+}
+
+// errCloser is a closer returning the error of the given function, such as
+// the first error writing the diagnostics as soon as they are reported.
+type errCloser func() error
+
+func (f errCloser) Close() error {
+	return f()
+}
+
+func proto(args []string) error {
+	flags := flag.NewFlagSet("proto", flag.ExitOnError)
+	config := flags.String("config", "", "path of the configuration file")
+	out := flags.String("out", "", "directory where the .proto files are written")
+	goCode := flags.Bool("go", false, "also write the Go servers and clients of the services")
+	setupReporter := diagnosticsFlags(flags)
+	flags.Parse(args)
+
+	if err := setupReporter(); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return fmt.Errorf("the output directory is required")
+	}
+
+	c, r, pkgs, err := load(*config, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	t := c.Transformer()
+	t.Reporter = reporter
+	protos := t.Transform(pkgs)
+	// The packages that can not be scanned are not generated, so their
+	// errors do not prevent generating the rest, though they still make
+	// the command fail.
+	if enforcer.Errors()-enforcer.CodeErrors(report.ScanError) > 0 {
+		return fmt.Errorf("no files were generated because of the errors found")
+	}
+
+	if err := protobuf.Generate(protos, *out); err != nil {
+		return err
+	}
+
+	if !*goCode {
+		return nil
+	}
+
+	g := gogen.NewGenerator()
+	g.Converters = r.Converters()
+	return g.Generate(protos, *out)
+}
+
+func graph(args []string) error {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	config := flags.String("config", "", "path of the configuration file")
+	format := flags.String("format", "dot", "output format: dot or mermaid")
+	typ := flags.String("type", "", "qualified name of the type whose dependents will be printed")
+	setupReporter := diagnosticsFlags(flags)
+	flags.Parse(args)
+
+	if err := setupReporter(); err != nil {
+		return err
+	}
+
+	write := map[string]func(*resolver.Graph) error{
+		"dot":     func(g *resolver.Graph) error { return g.WriteDOT(os.Stdout) },
+		"mermaid": func(g *resolver.Graph) error { return g.WriteMermaid(os.Stdout) },
+	}[*format]
+	if write == nil {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	_, _, pkgs, err := load(*config, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	full := pkgs.Graph()
+	g := full
+	if *typ != "" {
+		n := full.Node(*typ)
+		if n == nil {
+			return fmt.Errorf("type %s is not part of the schema", *typ)
+		}
+		g = full.Subgraph(append(full.DependentsOf(*typ), n))
+	}
+
+	if err := write(g); err != nil {
+		return err
+	}
+
+	cycles := full.PackageCycles()
+	for _, c := range cycles {
+		reporter.Report(&report.Diagnostic{
+			Severity: report.Error,
+			Code:     report.ImportCycle,
+			Message:  fmt.Sprintf("import cycle between packages %v", c),
+		})
+	}
+
+	if len(cycles) > 0 {
+		return fmt.Errorf("found %d import cycles", len(cycles))
+	}
+	return nil
+}
+
+// load scans and resolves the packages of the configuration file at the
+// given path or, if there is none, of the given paths. Packages that can
+// not be scanned are reported and the rest are returned, along with the
+// configuration and the resolver, which holds its mappings.
+func load(path string, paths []string) (*proteus.Config, *resolver.Resolver, resolver.Packages, error) {
+	config := &proteus.Config{Paths: paths}
+	if path != "" {
+		var err error
+		config, err = proteus.LoadConfig(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		config.Paths = append(config.Paths, paths...)
+	}
+
+	if len(config.Paths) == 0 {
+		return nil, nil, nil, fmt.Errorf("no packages to scan")
+	}
+
+	config.Strict = config.Strict || strict
+	policy, err := config.Policy()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	enforcer = policy.Reporter(reporter)
+	suppressions = report.NewSuppressionFilter(enforcer)
+	reporter = suppressions
+
+	s, err := config.Scanner()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	s.Reporter = reporter
+
+	r, err := config.Resolver()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r.Reporter = reporter
+
+	pkgs, err := s.Scan()
+	if scanErr, ok := err.(*scanner.ScanError); ok && len(pkgs) > 0 {
+		for _, e := range scanErr.Errors {
+			reporter.Report(&report.Diagnostic{
+				Severity: report.Error,
+				Code:     report.ScanError,
+				Message:  e.Error(),
+			})
+		}
+	} else if err != nil {
+		return nil, nil, nil, err
+	}
+
+	r.Resolve(pkgs)
+	return config, r, resolver.Packages(pkgs), nil
+}
+
+func reportError(err error) {
+	reporter.Report(&report.Diagnostic{
+		Severity: report.Error,
+		Code:     report.CommandError,
+		Message:  err.Error(),
+	})
+}
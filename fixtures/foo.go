@@ -14,6 +14,7 @@ type Foo struct {
 	Timestamp time.Time
 	External  url.URL
 	Duration  time.Duration
+	AliasQux  QuxAlias
 	Aliased   IntList
 }
 
@@ -23,3 +24,5 @@ type Qux struct {
 	A int
 	B int
 }
+
+type QuxAlias = Qux
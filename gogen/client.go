@@ -0,0 +1,391 @@
+package gogen
+
+import (
+	"fmt"
+	"go/types"
+	"io"
+	"strings"
+
+	"github.com/src-d/proteus/protobuf"
+)
+
+const grpcPackage = "google.golang.org/grpc"
+
+// clientLocals are the names of the local variables of the generated
+// clients, which can not be used as aliases of the imported packages nor
+// as names of the parameters and results.
+var clientLocals = []string{"c", "cc", "opts", "ctx", "cancel", "req", "resp", "stream", "v", "ch", "errc", "err"}
+
+// WriteClients writes the Go code of the clients of the services of the
+// given package. For every service, a `<Service>GoClient` type has a
+// method per RPC with the signature of its function or method, except for
+// a leading context.Context and a trailing error, which all of them have.
+// The methods convert their arguments into the requests, call the RPCs
+// through the client generated by protoc and convert the responses into
+// their results, so calling a function remotely looks like calling it
+// locally. Functions whose signature refers to types that are not visible
+// outside of their package have no method.
+// A channel result is followed by a `<-chan error` result, which receives
+// the error that ended the stream, if any, once the channel of values is
+// closed, and is closed right after. The error is the one of the RPC, of a
+// conversion or of the context, if it is done first.
+func (g *Generator) WriteClients(w io.Writer, p *protobuf.Package) error {
+	f := newFile(goPackageName(p), clientLocals...)
+	f.reserveImport("context")
+	f.importPath(grpcPackage)
+	f.reserveImport(rpcPackage)
+
+	for _, s := range p.Services {
+		writeClient(f, p, s)
+	}
+
+	src, err := f.source()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+func writeClient(f *file, p *protobuf.Package, s *protobuf.Service) {
+	var (
+		svc = goCamelCase(s.Name)
+		typ = svc + "GoClient"
+	)
+
+	if s.Receiver != nil {
+		f.line("// %s is a client of %s calling the methods of", typ, svc)
+		f.line("// %s.%s with their own types.", p.Path, s.Receiver.Name)
+	} else {
+		f.line("// %s is a client of %s calling the functions of", typ, svc)
+		f.line("// package %s with their own types.", p.Path)
+	}
+	f.line("type %s struct {", typ)
+	f.line("client %sClient", svc)
+	f.line("opts []grpc.CallOption")
+	f.line("}")
+	f.line("")
+	f.line("// New%s returns a %s calling the RPCs", typ, typ)
+	f.line("// through the given connection with the given options.")
+	f.line("func New%s(cc grpc.ClientConnInterface, opts ...grpc.CallOption) *%s {", typ, typ)
+	f.line("return &%s{client: New%sClient(cc), opts: opts}", typ, svc)
+	f.line("}")
+
+	for _, r := range s.RPCs {
+		if r.Func == nil || r.Func.Signature == nil || !visibleSignature(r.Func.Signature) {
+			continue
+		}
+
+		f.line("")
+		writeClientMethod(f, p, typ, r)
+	}
+	f.line("")
+}
+
+// clientVar is a parameter or result of a client method.
+type clientVar struct {
+	name string
+	typ  types.Type
+	// field is the name of the field of the message it is converted to or
+	// from.
+	field string
+}
+
+// writeClientMethod writes the method of the client type with the given
+// name calling the given RPC.
+func writeClientMethod(f *file, p *protobuf.Package, typ string, r *protobuf.RPC) {
+	var (
+		fn     = r.Func
+		sig    = fn.Signature
+		method = goCamelCase(r.Name)
+		in     = p.Message(r.Input)
+		out    = p.Message(r.Output)
+
+		params, results      []*clientVar
+		sendCh, recvCh, errs *clientVar
+		resultCh             bool
+		reqArgs, reqDsts     []string
+		respSrcs, resultDsts []string
+	)
+
+	offset := 0
+	if fn.Context {
+		offset = 1
+	}
+
+	var k int
+	for i := offset; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+		if ch, ok := types.Unalias(v.Type()).(*types.Chan); ok {
+			cv := &clientVar{name: v.Name(), typ: v.Type()}
+			if ch.Dir() == types.RecvOnly {
+				cv.field = in.Fields[0].Name
+				sendCh = cv
+			} else {
+				cv.field = out.Fields[0].Name
+				recvCh = cv
+			}
+			params = append(params, cv)
+			continue
+		}
+
+		params = append(params, &clientVar{name: v.Name(), typ: v.Type(), field: in.Fields[k].Name})
+		k++
+	}
+
+	n := sig.Results().Len()
+	if fn.Error {
+		n--
+	}
+
+	k = 0
+	for i := 0; i < n; i++ {
+		v := sig.Results().At(i)
+		if _, ok := types.Unalias(v.Type()).(*types.Chan); ok {
+			cv := &clientVar{name: v.Name(), typ: v.Type(), field: out.Fields[0].Name}
+			recvCh, resultCh = cv, true
+			errs = &clientVar{name: "errs", typ: types.NewChan(types.RecvOnly, types.Universe.Lookup("error").Type()), field: "errs"}
+			results = append(results, cv, errs)
+			continue
+		}
+
+		results = append(results, &clientVar{name: v.Name(), typ: v.Type(), field: out.Fields[k].Name})
+		k++
+	}
+
+	// The types are written before naming the variables, so the aliases of
+	// the packages they import are not taken as names.
+	var decls = make(map[*clientVar]string)
+	for _, v := range append(params, results...) {
+		decls[v] = f.typeString(v.typ)
+	}
+
+	var names = make(map[string]bool)
+	for _, v := range append(params, results...) {
+		v.name = f.localName(names, v.name, v.field)
+	}
+
+	var paramDecls, resultDecls = []string{"ctx context.Context"}, []string{}
+	for _, v := range params {
+		paramDecls = append(paramDecls, v.name+" "+decls[v])
+		if v != sendCh && v != recvCh {
+			reqArgs = append(reqArgs, v.name)
+			reqDsts = append(reqDsts, "&req."+goCamelCase(v.field))
+		}
+	}
+	for _, v := range results {
+		resultDecls = append(resultDecls, v.name+" "+decls[v])
+		if v != recvCh && v != errs {
+			respSrcs = append(respSrcs, "resp."+goCamelCase(v.field))
+			resultDsts = append(resultDsts, "&"+v.name)
+		}
+	}
+	resultDecls = append(resultDecls, "err error")
+
+	f.importPath("context")
+	f.line("func (c *%s) %s(%s) (%s) {", typ, method,
+		strings.Join(paramDecls, ", "), strings.Join(resultDecls, ", "))
+
+	if !r.ClientStreaming {
+		f.line("var req %s", goCamelCase(r.Input))
+		if len(reqArgs) > 0 {
+			f.line("if err = %s; err != nil {", f.convertAll(reqArgs, reqDsts))
+			f.line("return")
+			f.line("}")
+			f.line("")
+		}
+	}
+
+	if !r.ClientStreaming && !r.ServerStreaming {
+		if len(respSrcs) == 0 {
+			f.line("_, err = c.client.%s(ctx, &req, c.opts...)", method)
+			f.line("return")
+			f.line("}")
+			return
+		}
+
+		f.line("resp, err := c.client.%s(ctx, &req, c.opts...)", method)
+		f.line("if err != nil {")
+		f.line("return")
+		f.line("}")
+		f.line("")
+		f.line("err = %s", f.convertAll(respSrcs, resultDsts))
+		f.line("return")
+		f.line("}")
+		return
+	}
+
+	f.importPath(rpcPackage)
+	f.line("ctx, cancel := context.WithCancel(ctx)")
+	if !resultCh {
+		f.line("defer cancel()")
+	}
+	f.line("")
+
+	if r.ClientStreaming {
+		f.line("stream, err := c.client.%s(ctx, c.opts...)", method)
+	} else {
+		f.line("stream, err := c.client.%s(ctx, &req, c.opts...)", method)
+	}
+	f.line("if err != nil {")
+	if resultCh {
+		f.line("cancel()")
+	}
+	f.line("return")
+	f.line("}")
+	f.line("")
+
+	switch {
+	case r.ClientStreaming && !r.ServerStreaming:
+		f.line("if err = rpc.SendStream(ctx, %s, %s); err != nil {", sendCh.name, sendFunc(r.Input, sendCh.field))
+		f.line("return")
+		f.line("}")
+		f.line("")
+		if len(respSrcs) == 0 {
+			f.line("_, err = stream.CloseAndRecv()")
+			f.line("return")
+			break
+		}
+
+		f.line("resp, err := stream.CloseAndRecv()")
+		f.line("if err != nil {")
+		f.line("return")
+		f.line("}")
+		f.line("")
+		f.line("err = %s", f.convertAll(respSrcs, resultDsts))
+		f.line("return")
+	case resultCh:
+		f.line("ch, errc := make(chan %s), make(chan error, 1)", f.typeString(types.Unalias(recvCh.typ).(*types.Chan).Elem()))
+		f.line("go func() {")
+		if r.ClientStreaming {
+			f.line("err := rpc.Exchange(ctx, cancel, %s, %s, stream.CloseSend, %s, ch)",
+				sendCh.name, sendFunc(r.Input, sendCh.field), recvFunc(recvCh.field))
+		} else {
+			f.line("defer cancel()")
+			f.line("err := rpc.ReceiveStream(ctx, %s, ch)", recvFunc(recvCh.field))
+		}
+		f.line("close(ch)")
+		f.line("if err != nil {")
+		f.line("errc <- err")
+		f.line("}")
+		f.line("close(errc)")
+		f.line("}()")
+		f.line("return ch, errc, nil")
+	case r.ClientStreaming:
+		f.line("return rpc.Exchange(ctx, cancel, %s, %s, stream.CloseSend, %s, %s)",
+			sendCh.name, sendFunc(r.Input, sendCh.field), recvFunc(recvCh.field), recvCh.name)
+	default:
+		f.line("return rpc.ReceiveStream(ctx, %s, %s)", recvFunc(recvCh.field), recvCh.name)
+	}
+	f.line("}")
+}
+
+// convertAll returns the expression converting the given sources into the
+// given destinations with rpc.ConvertAll.
+func (f *file) convertAll(srcs, dsts []string) string {
+	f.importPath(rpcPackage)
+	return fmt.Sprintf("rpc.ConvertAll([]interface{}{%s}, []interface{}{%s})",
+		strings.Join(srcs, ", "), strings.Join(dsts, ", "))
+}
+
+// sendFunc returns the expression of the function sending the values of
+// the client stream in the given field of the given input message.
+func sendFunc(in, field string) string {
+	return fmt.Sprintf(`func(v interface{}) error {
+	var req %s
+	if err := rpc.Convert(v, &req.%s); err != nil {
+		return err
+	}
+	return stream.Send(&req)
+}`, goCamelCase(in), goCamelCase(field))
+}
+
+// recvFunc returns the expression of the function receiving the values of
+// the server stream in the given field of the output messages.
+func recvFunc(field string) string {
+	return fmt.Sprintf(`func() (interface{}, error) {
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return resp.%s, nil
+}`, goCamelCase(field))
+}
+
+// typeString returns the expression of the given type in the file,
+// importing the packages it refers to.
+func (f *file) typeString(t types.Type) string {
+	return types.TypeString(t, func(pkg *types.Package) string {
+		return f.importPath(pkg.Path())
+	})
+}
+
+// localName returns a name for a local variable, which is the given name
+// unless it is empty, blank or taken, in which case it is the name of the
+// given field. It is suffixed with a number if that one is taken too. The
+// returned name is added to the given taken names.
+func (f *file) localName(taken map[string]bool, name, field string) string {
+	if name == "" || name == "_" || f.reserved[name] || taken[name] {
+		name = lowerFirst(goCamelCase(field))
+	}
+
+	base := name
+	for i := 2; f.reserved[name] || taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+
+	taken[name] = true
+	return name
+}
+
+// visibleSignature reports whether all the types of the parameters and
+// results of the given signature can be referred to from another package.
+func visibleSignature(sig *types.Signature) bool {
+	for _, tuple := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < tuple.Len(); i++ {
+			if !visible(tuple.At(i).Type()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// visible reports whether the given type can be referred to from another
+// package.
+func visible(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return true
+	case *types.Alias:
+		return visibleObject(t.Obj()) && visibleTypes(t.TypeArgs())
+	case *types.Named:
+		return visibleObject(t.Obj()) && visibleTypes(t.TypeArgs())
+	case *types.Pointer:
+		return visible(t.Elem())
+	case *types.Slice:
+		return visible(t.Elem())
+	case *types.Array:
+		return visible(t.Elem())
+	case *types.Chan:
+		return visible(t.Elem())
+	case *types.Map:
+		return visible(t.Key()) && visible(t.Elem())
+	default:
+		return false
+	}
+}
+
+func visibleObject(obj *types.TypeName) bool {
+	return obj.Pkg() == nil || obj.Exported()
+}
+
+func visibleTypes(list *types.TypeList) bool {
+	for i := 0; i < list.Len(); i++ {
+		if !visible(list.At(i)) {
+			return false
+		}
+	}
+	return true
+}
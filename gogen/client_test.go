@@ -0,0 +1,244 @@
+package gogen
+
+import (
+	"bytes"
+	"go/types"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/proteus/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteClients(t *testing.T) {
+	require := require.New(t)
+
+	path := testutil.ProjectPath("fixtures/overlay/events")
+	protos := transform(t, map[string]string{
+		filepath.Join(path, "events.go"): `//proteus:service
+package events
+
+import (
+	"context"
+	"time"
+)
+
+type Event struct {
+	Name string
+}
+
+func Get(ctx context.Context, c string, _ int64) (*Event, time.Duration, error) {
+	return nil, 0, nil
+}
+
+func Publish(events <-chan Event) error {
+	return nil
+}
+
+func Watch(topic string) <-chan Event {
+	return nil
+}
+
+//proteus:service
+type Store struct{}
+
+func (s Store) Put(e Event) {}
+`,
+	}, path)
+
+	var buf bytes.Buffer
+	require.Nil(NewGenerator().WriteClients(&buf, protos[0]))
+	require.Equal(testutil.Project+"/fixtures/overlay/events/pb/client.proteus.go", ClientFileName(protos[0]))
+
+	expected := `// Code generated by proteus. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	events "github.com/src-d/proteus/fixtures/overlay/events"
+	rpc "github.com/src-d/proteus/rpc"
+	grpc "google.golang.org/grpc"
+	time "time"
+)
+
+// EventsServiceGoClient is a client of EventsService calling the functions of
+// package github.com/src-d/proteus/fixtures/overlay/events with their own types.
+type EventsServiceGoClient struct {
+	client EventsServiceClient
+	opts   []grpc.CallOption
+}
+
+// NewEventsServiceGoClient returns a EventsServiceGoClient calling the RPCs
+// through the given connection with the given options.
+func NewEventsServiceGoClient(cc grpc.ClientConnInterface, opts ...grpc.CallOption) *EventsServiceGoClient {
+	return &EventsServiceGoClient{client: NewEventsServiceClient(cc), opts: opts}
+}
+
+func (c *EventsServiceGoClient) Get(ctx context.Context, c2 string, arg2 int64) (result1 *events.Event, result2 time.Duration, err error) {
+	var req GetRequest
+	if err = rpc.ConvertAll([]interface{}{c2, arg2}, []interface{}{&req.C, &req.Arg2}); err != nil {
+		return
+	}
+
+	resp, err := c.client.Get(ctx, &req, c.opts...)
+	if err != nil {
+		return
+	}
+
+	err = rpc.ConvertAll([]interface{}{resp.Result1, resp.Result2}, []interface{}{&result1, &result2})
+	return
+}
+
+func (c *EventsServiceGoClient) Publish(ctx context.Context, events2 <-chan events.Event) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.Publish(ctx, c.opts...)
+	if err != nil {
+		return
+	}
+
+	if err = rpc.SendStream(ctx, events2, func(v interface{}) error {
+		var req PublishRequest
+		if err := rpc.Convert(v, &req.Events); err != nil {
+			return err
+		}
+		return stream.Send(&req)
+	}); err != nil {
+		return
+	}
+
+	_, err = stream.CloseAndRecv()
+	return
+}
+
+func (c *EventsServiceGoClient) Watch(ctx context.Context, topic string) (result <-chan events.Event, errs <-chan error, err error) {
+	var req WatchRequest
+	if err = rpc.ConvertAll([]interface{}{topic}, []interface{}{&req.Topic}); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := c.client.Watch(ctx, &req, c.opts...)
+	if err != nil {
+		cancel()
+		return
+	}
+
+	ch, errc := make(chan events.Event), make(chan error, 1)
+	go func() {
+		defer cancel()
+		err := rpc.ReceiveStream(ctx, func() (interface{}, error) {
+			resp, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return resp.Result, nil
+		}, ch)
+		close(ch)
+		if err != nil {
+			errc <- err
+		}
+		close(errc)
+	}()
+	return ch, errc, nil
+}
+
+// StoreServiceGoClient is a client of StoreService calling the methods of
+// github.com/src-d/proteus/fixtures/overlay/events.Store with their own types.
+type StoreServiceGoClient struct {
+	client StoreServiceClient
+	opts   []grpc.CallOption
+}
+
+// NewStoreServiceGoClient returns a StoreServiceGoClient calling the RPCs
+// through the given connection with the given options.
+func NewStoreServiceGoClient(cc grpc.ClientConnInterface, opts ...grpc.CallOption) *StoreServiceGoClient {
+	return &StoreServiceGoClient{client: NewStoreServiceClient(cc), opts: opts}
+}
+
+func (c *StoreServiceGoClient) Put(ctx context.Context, e events.Event) (err error) {
+	var req StorePutRequest
+	if err = rpc.ConvertAll([]interface{}{e}, []interface{}{&req.E}); err != nil {
+		return
+	}
+
+	_, err = c.client.Put(ctx, &req, c.opts...)
+	return
+}
+`
+	require.Equal(expected, buf.String())
+}
+
+func TestWriteClientsWithoutConversions(t *testing.T) {
+	require := require.New(t)
+
+	dir, _ := buildDir(t)
+	files := map[string]string{
+		"ping.go": `//proteus:service
+package ping
+
+import "context"
+
+func Ping(ctx context.Context) error {
+	return nil
+}
+`,
+	}
+	protos := transform(t, map[string]string{filepath.Join(dir, "ping.go"): files["ping.go"]}, dir)
+
+	var buf bytes.Buffer
+	require.Nil(NewGenerator().WriteClients(&buf, protos[0]))
+	require.NotContains(buf.String(), rpcPackage, "no values are converted")
+
+	files["pb/client.proteus.go"] = buf.String()
+	files["pb/ping.pb.go"] = `package pb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type PingRequest struct{}
+
+type PingResponse struct{}
+
+type PingServiceClient interface {
+	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
+}
+
+func NewPingServiceClient(cc grpc.ClientConnInterface) PingServiceClient {
+	return nil
+}
+`
+	build(t, dir, files)
+}
+
+func TestVisible(t *testing.T) {
+	pkg := types.NewPackage("example.com/events", "events")
+	named := func(name string) types.Type {
+		return types.NewNamed(types.NewTypeName(0, pkg, name, nil), types.Typ[types.Int], nil)
+	}
+
+	cases := []struct {
+		typ      types.Type
+		expected bool
+	}{
+		{types.Typ[types.String], true},
+		{named("Event"), true},
+		{named("event"), false},
+		{types.Universe.Lookup("error").Type(), true},
+		{types.NewPointer(named("Event")), true},
+		{types.NewSlice(named("event")), false},
+		{types.NewMap(types.Typ[types.String], named("event")), false},
+		{types.NewChan(types.RecvOnly, named("Event")), true},
+		{types.NewStruct(nil, nil), false},
+	}
+
+	for _, c := range cases {
+		require.Equal(t, c.expected, visible(c.typ), c.typ.String())
+	}
+}
@@ -0,0 +1,265 @@
+// Package gogen generates the Go code serving the services of protobuf
+// packages with the functions and methods they are generated from, and
+// the Go code calling them with the types of those functions and methods.
+// The code lives in the Go packages of the protobuf packages, along with
+// the code generated by protoc for them, and converts the values with the
+// runtime support of the rpc package.
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/src-d/proteus/protobuf"
+)
+
+const rpcPackage = "github.com/src-d/proteus/rpc"
+
+// Generator generates the Go code of the services of protobuf packages.
+type Generator struct {
+	// Converters are the qualified names of the functions registered
+	// with rpc.RegisterConverter by the generated code, such as
+	// `github.com/foo/conv.UUIDToString`. They are usually the functions
+	// encoding and decoding the types mapped to other types.
+	Converters []string
+}
+
+// NewGenerator returns a new generator.
+func NewGenerator() *Generator {
+	return &Generator{}
+}
+
+// ServerFileName returns the path of the file with the servers of the
+// given package, relative to the directory of all the generated files. It
+// is in the directory of the Go package of the protobuf package, where
+// protoc writes the code generated for it when its output directory is
+// the same.
+func ServerFileName(p *protobuf.Package) string {
+	return path.Join(goPackagePath(p), "server.proteus.go")
+}
+
+// ClientFileName returns the path of the file with the clients of the
+// given package, relative to the directory of all the generated files,
+// which is next to the file with the servers.
+func ClientFileName(p *protobuf.Package) string {
+	return path.Join(goPackagePath(p), "client.proteus.go")
+}
+
+// Generate writes the Go code of the servers and clients of the services
+// of the given packages in the given directory. Packages without services
+// are skipped.
+func (g *Generator) Generate(pkgs []*protobuf.Package, dir string) error {
+	for _, p := range pkgs {
+		if len(p.Services) == 0 {
+			continue
+		}
+
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(ServerFileName(p))), func(w io.Writer) error {
+			return g.WriteServers(w, p)
+		}); err != nil {
+			return err
+		}
+
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(ClientFileName(p))), func(w io.Writer) error {
+			return g.WriteClients(w, p)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write %s: %s", path, err)
+	}
+
+	return f.Close()
+}
+
+// goPackagePath returns the import path of the Go package of the given
+// protobuf package.
+func goPackagePath(p *protobuf.Package) string {
+	if i := strings.Index(p.GoPackage, ";"); i >= 0 {
+		return strings.TrimPrefix(p.GoPackage[:i], "/")
+	}
+	return strings.TrimPrefix(p.GoPackage, "/")
+}
+
+// goPackageName returns the name of the Go package of the given protobuf
+// package.
+func goPackageName(p *protobuf.Package) string {
+	if i := strings.Index(p.GoPackage, ";"); i >= 0 {
+		return p.GoPackage[i+1:]
+	}
+	return identifier(path.Base(p.GoPackage))
+}
+
+// file is a Go source file being generated.
+type file struct {
+	bytes.Buffer
+	pkg string
+	// imports are the aliases of the imported packages, indexed by path.
+	imports map[string]string
+	// used are the paths of the imported packages used by the code, which
+	// are the only ones written.
+	used map[string]bool
+	// reserved are the identifiers that can not be used as aliases.
+	reserved map[string]bool
+}
+
+func newFile(pkg string, reserved ...string) *file {
+	f := &file{
+		pkg:      pkg,
+		imports:  make(map[string]string),
+		used:     make(map[string]bool),
+		reserved: make(map[string]bool),
+	}
+	for _, r := range reserved {
+		f.reserved[r] = true
+	}
+	return f
+}
+
+// importPath returns the alias of the package with the given path, which
+// is imported if it was not already.
+func (f *file) importPath(p string) string {
+	f.used[p] = true
+	return f.reserveImport(p)
+}
+
+// reserveImport returns the alias of the package with the given path
+// without importing it, so the alias is taken and the package gets it if
+// it is imported later on.
+func (f *file) reserveImport(p string) string {
+	if alias, ok := f.imports[p]; ok {
+		return alias
+	}
+
+	base := identifier(path.Base(p))
+	alias := base
+	for i := 2; f.reserved[alias]; i++ {
+		alias = fmt.Sprintf("%s%d", base, i)
+	}
+
+	f.imports[p] = alias
+	f.reserved[alias] = true
+	return alias
+}
+
+func (f *file) line(format string, args ...interface{}) {
+	fmt.Fprintf(f, format, args...)
+	f.WriteString("\n")
+}
+
+// source returns the formatted source of the file, including the package
+// clause and the imports.
+func (f *file) source() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by proteus. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", f.pkg)
+
+	var paths []string
+	for p := range f.used {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	buf.WriteString("import (\n")
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "\t%s %q\n", f.imports[p], p)
+	}
+	buf.WriteString(")\n\n")
+	buf.Write(f.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %s", err)
+	}
+	return src, nil
+}
+
+// identifier returns the given name with all the characters that are not
+// valid in an identifier replaced by underscores.
+func identifier(name string) string {
+	id := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "_" + id
+	}
+	return id
+}
+
+// goCamelCase returns the name of the Go identifier generated by protoc
+// for the protobuf identifier with the given name, such as `UserId` for
+// the field `user_id`.
+func goCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isASCIILower(s[i+1]):
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isASCIILower(s[i+1]):
+		case isASCIIDigit(c):
+			b = append(b, c)
+		default:
+			if isASCIILower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isASCIILower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+func isASCIILower(c byte) bool { return 'a' <= c && c <= 'z' }
+func isASCIIDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// lowerFirst returns the given identifier with its first letter in lower
+// case, so it is not exported.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// splitQualifiedName splits a qualified name such as
+// `github.com/foo/conv.UUIDToString` into its package path and name.
+func splitQualifiedName(name string) (string, string, error) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 || strings.LastIndex(name, "/") > i {
+		return "", "", fmt.Errorf("invalid qualified name %q", name)
+	}
+	return name[:i], name[i+1:], nil
+}
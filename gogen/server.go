@@ -0,0 +1,243 @@
+package gogen
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/src-d/proteus/protobuf"
+	"github.com/src-d/proteus/scanner"
+)
+
+// locals are the names of the local variables of the generated code,
+// which can not be used as aliases of the imported packages.
+var locals = []string{"s", "ctx", "req", "resp", "stream", "v", "err", "impl"}
+
+// WriteServers writes the Go code of the servers of the services of the
+// given package. For every service, a `New<Service>Server` function
+// returns the implementation of the server interface generated by protoc
+// for it, whose methods convert the requests into the parameters of the
+// functions or methods of the RPCs, call them and convert their results
+// into the responses. Services of the methods of a type receive the value
+// the methods are called on.
+func (g *Generator) WriteServers(w io.Writer, p *protobuf.Package) error {
+	f := newFile(goPackageName(p))
+	f.reserveImport("context")
+	f.reserveImport(rpcPackage)
+	for _, l := range locals {
+		f.reserved[l] = true
+	}
+
+	if err := g.writeConverters(f); err != nil {
+		return err
+	}
+
+	for _, s := range p.Services {
+		writeServer(f, p, s)
+	}
+
+	src, err := f.source()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+// writeConverters writes the registration of the converters of the
+// generator.
+func (g *Generator) writeConverters(f *file) error {
+	if len(g.Converters) == 0 {
+		return nil
+	}
+
+	f.importPath(rpcPackage)
+	f.line("func init() {")
+	for _, c := range g.Converters {
+		path, name, err := splitQualifiedName(c)
+		if err != nil {
+			return fmt.Errorf("invalid converter: %s", err)
+		}
+		f.line("rpc.RegisterConverter(%s.%s)", f.importPath(path), name)
+	}
+	f.line("}")
+	f.line("")
+	return nil
+}
+
+func writeServer(f *file, p *protobuf.Package, s *protobuf.Service) {
+	var (
+		svc  = goCamelCase(s.Name)
+		typ  = lowerFirst(svc) + "Server"
+		impl string
+	)
+	if s.Receiver != nil {
+		impl = fmt.Sprintf("%s.%s", f.importPath(p.Path), s.Receiver.Name)
+		if s.Receiver.Pointer {
+			impl = "*" + impl
+		}
+	}
+
+	f.line("type %s struct {", typ)
+	f.line("Unimplemented%sServer", svc)
+	if impl != "" {
+		f.line("impl %s", impl)
+	}
+	f.line("}")
+	f.line("")
+
+	if impl != "" {
+		f.line("// New%sServer returns a %sServer calling the methods of the given", svc, svc)
+		f.line("// %s.", s.Receiver.Name)
+		f.line("func New%sServer(impl %s) %sServer {", svc, impl, svc)
+		f.line("return &%s{impl: impl}", typ)
+	} else {
+		f.line("// New%sServer returns a %sServer calling the functions of package", svc, svc)
+		f.line("// %s.", p.Path)
+		f.line("func New%sServer() %sServer {", svc, svc)
+		f.line("return &%s{}", typ)
+	}
+	f.line("}")
+
+	for _, r := range s.RPCs {
+		f.line("")
+		writeServerMethod(f, p, s, typ, r)
+	}
+	f.line("")
+}
+
+// writeServerMethod writes the method of the server type with the given
+// name implementing the given RPC.
+func writeServerMethod(f *file, p *protobuf.Package, s *protobuf.Service, typ string, r *protobuf.RPC) {
+	var (
+		fn     = r.Func
+		method = goCamelCase(r.Name)
+		in     = p.Message(r.Input)
+		out    = p.Message(r.Output)
+		stream = fmt.Sprintf("%s_%sServer", goCamelCase(s.Name), method)
+		callee = fmt.Sprintf("s.impl.%s", fn.Name)
+	)
+	if s.Receiver == nil {
+		callee = fmt.Sprintf("%s.%s", f.importPath(p.Path), fn.Name)
+	}
+
+	ctx := "ctx"
+	if r.ClientStreaming || r.ServerStreaming {
+		ctx = "stream.Context()"
+	}
+
+	f.importPath(rpcPackage)
+	args := callArgs(fn, in, out, ctx)
+	results := callResults(fn, out)
+	call := fmt.Sprintf("rpc.Call(%s, []interface{}{%s}, []interface{}{%s})",
+		callee, strings.Join(args, ", "), strings.Join(results, ", "))
+
+	switch {
+	case !r.ClientStreaming && !r.ServerStreaming:
+		f.importPath("context")
+		f.line("func (s *%s) %s(ctx context.Context, req *%s) (*%s, error) {", typ, method, goCamelCase(r.Input), goCamelCase(r.Output))
+		f.line("var resp %s", goCamelCase(r.Output))
+		f.line("if err := %s; err != nil {", call)
+		f.line("return nil, err")
+		f.line("}")
+		f.line("return &resp, nil")
+	case r.ClientStreaming && !r.ServerStreaming:
+		f.line("func (s *%s) %s(stream %s) error {", typ, method, stream)
+		f.line("var resp %s", goCamelCase(r.Output))
+		f.line("if err := %s; err != nil {", call)
+		f.line("return err")
+		f.line("}")
+		f.line("return stream.SendAndClose(&resp)")
+	case r.ServerStreaming && !r.ClientStreaming:
+		f.line("func (s *%s) %s(req *%s, stream %s) error {", typ, method, goCamelCase(r.Input), stream)
+		f.line("return %s", call)
+	default:
+		f.line("func (s *%s) %s(stream %s) error {", typ, method, stream)
+		f.line("return %s", call)
+	}
+	f.line("}")
+}
+
+// callArgs returns the expressions of the arguments of the call to the
+// given func, whose input and output messages are given, with the given
+// expression of the context.
+func callArgs(fn *scanner.Func, in, out *protobuf.Message, ctx string) []string {
+	var args []string
+	for i := range fn.Params {
+		args = append(args, "req."+goCamelCase(in.Fields[i].Name))
+	}
+
+	var streams []*scanner.Stream
+	if fn.ClientStream != nil {
+		streams = append(streams, fn.ClientStream)
+	}
+	if fn.ServerStream != nil && !fn.ServerStream.Result {
+		streams = append(streams, fn.ServerStream)
+	}
+	if len(streams) == 2 && streams[1].Index < streams[0].Index {
+		streams[0], streams[1] = streams[1], streams[0]
+	}
+
+	for _, s := range streams {
+		expr := sendStream(out)
+		if s == fn.ClientStream {
+			expr = recvStream(in)
+		}
+		args = insert(args, s.Index, expr)
+	}
+
+	if fn.Context {
+		args = insert(args, 0, ctx)
+	}
+	return args
+}
+
+// callResults returns the expressions of the destinations of the results
+// of the call to the given func, whose output message is given.
+func callResults(fn *scanner.Func, out *protobuf.Message) []string {
+	var results []string
+	for i := range fn.Results {
+		results = append(results, "&resp."+goCamelCase(out.Fields[i].Name))
+	}
+
+	if s := fn.ServerStream; s != nil && s.Result {
+		results = insert(results, s.Index, sendStream(out))
+	}
+	return results
+}
+
+// recvStream returns the expression of the client stream receiving the
+// messages of the given input message.
+func recvStream(in *protobuf.Message) string {
+	return fmt.Sprintf(`rpc.ClientStream(func() (interface{}, error) {
+	req, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return req.%s, nil
+})`, goCamelCase(in.Fields[0].Name))
+}
+
+// sendStream returns the expression of the server stream sending the
+// messages of the given output message.
+func sendStream(out *protobuf.Message) string {
+	return fmt.Sprintf(`rpc.ServerStream(func(v interface{}) error {
+	var resp %s
+	if err := rpc.Convert(v, &resp.%s); err != nil {
+		return err
+	}
+	return stream.Send(&resp)
+})`, goCamelCase(out.Name), goCamelCase(out.Fields[0].Name))
+}
+
+func insert(list []string, i int, s string) []string {
+	if i > len(list) {
+		i = len(list)
+	}
+
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
@@ -0,0 +1,247 @@
+package gogen
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/proteus/internal/testutil"
+	"github.com/src-d/proteus/protobuf"
+	"github.com/src-d/proteus/report"
+	"github.com/stretchr/testify/require"
+)
+
+func transform(t *testing.T, files map[string]string, paths ...string) []*protobuf.Package {
+	tr := protobuf.NewTransformer()
+	tr.Reporter = report.Discard
+	return tr.Transform(testutil.Scan(t, files, paths...))
+}
+
+func TestWriteServers(t *testing.T) {
+	require := require.New(t)
+
+	path := testutil.ProjectPath("fixtures/overlay/feed")
+	protos := transform(t, map[string]string{
+		filepath.Join(path, "feed.go"): `//proteus:service
+package feed
+
+import "context"
+
+type Event struct {
+	Name string
+}
+
+func Publish(ctx context.Context, events <-chan Event) (int64, error) {
+	return 0, nil
+}
+
+func Watch(ctx context.Context, topic string, events chan<- Event) error {
+	return nil
+}
+
+//proteus:service
+type Store struct{}
+
+func (s *Store) Get(ctx context.Context, name string) (*Event, error) {
+	return nil, nil
+}
+`,
+	}, path)
+
+	g := NewGenerator()
+	g.Converters = []string{"example.com/conv.StringToEvent"}
+
+	var buf bytes.Buffer
+	require.Nil(g.WriteServers(&buf, protos[0]))
+	require.Equal(testutil.Project+"/fixtures/overlay/feed/pb/server.proteus.go", ServerFileName(protos[0]))
+
+	expected := `// Code generated by proteus. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	conv "example.com/conv"
+	feed "github.com/src-d/proteus/fixtures/overlay/feed"
+	rpc "github.com/src-d/proteus/rpc"
+)
+
+func init() {
+	rpc.RegisterConverter(conv.StringToEvent)
+}
+
+type feedServiceServer struct {
+	UnimplementedFeedServiceServer
+}
+
+// NewFeedServiceServer returns a FeedServiceServer calling the functions of package
+// github.com/src-d/proteus/fixtures/overlay/feed.
+func NewFeedServiceServer() FeedServiceServer {
+	return &feedServiceServer{}
+}
+
+func (s *feedServiceServer) Publish(stream FeedService_PublishServer) error {
+	var resp PublishResponse
+	if err := rpc.Call(feed.Publish, []interface{}{stream.Context(), rpc.ClientStream(func() (interface{}, error) {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return req.Events, nil
+	})}, []interface{}{&resp.Result}); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&resp)
+}
+
+func (s *feedServiceServer) Watch(req *WatchRequest, stream FeedService_WatchServer) error {
+	return rpc.Call(feed.Watch, []interface{}{stream.Context(), req.Topic, rpc.ServerStream(func(v interface{}) error {
+		var resp WatchResponse
+		if err := rpc.Convert(v, &resp.Events); err != nil {
+			return err
+		}
+		return stream.Send(&resp)
+	})}, []interface{}{})
+}
+
+type storeServiceServer struct {
+	UnimplementedStoreServiceServer
+	impl *feed.Store
+}
+
+// NewStoreServiceServer returns a StoreServiceServer calling the methods of the given
+// Store.
+func NewStoreServiceServer(impl *feed.Store) StoreServiceServer {
+	return &storeServiceServer{impl: impl}
+}
+
+func (s *storeServiceServer) Get(ctx context.Context, req *StoreGetRequest) (*StoreGetResponse, error) {
+	var resp StoreGetResponse
+	if err := rpc.Call(s.impl.Get, []interface{}{ctx, req.Name}, []interface{}{&resp.Result}); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+`
+	require.Equal(expected, buf.String())
+}
+
+// buildDir returns a new directory in the fixtures of the project, which
+// is removed once the test ends, along with its import path.
+func buildDir(t *testing.T) (string, string) {
+	dir, err := os.MkdirTemp(testutil.ProjectPath("fixtures"), "build")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir, testutil.Project + "/fixtures/" + filepath.Base(dir)
+}
+
+// build writes the given files, indexed by their path relative to the
+// given directory, and builds all the packages in the directory with the
+// go command, failing the test if they do not compile.
+func build(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.Nil(t, err, "%s", out)
+}
+
+func TestWriteServersStreamingOnly(t *testing.T) {
+	require := require.New(t)
+
+	dir, path := buildDir(t)
+	files := map[string]string{
+		"events.go": `//proteus:service
+package events
+
+import "context"
+
+type Event struct {
+	Name string
+}
+
+func Watch(ctx context.Context, topic string, events chan<- Event) error {
+	return nil
+}
+`,
+	}
+	protos := transform(t, map[string]string{filepath.Join(dir, "events.go"): files["events.go"]}, dir)
+
+	var buf bytes.Buffer
+	require.Nil(NewGenerator().WriteServers(&buf, protos[0]))
+	require.NotContains(buf.String(), `"context"`, "only unary methods use context")
+
+	files["pb/server.proteus.go"] = buf.String()
+	files["pb/events.pb.go"] = `package pb
+
+import "context"
+
+type Event struct {
+	Name string
+}
+
+type WatchRequest struct {
+	Topic string
+}
+
+type WatchResponse struct {
+	Events *Event
+}
+
+type EventsServiceServer interface {
+	Watch(*WatchRequest, EventsService_WatchServer) error
+}
+
+type UnimplementedEventsServiceServer struct{}
+
+type EventsService_WatchServer interface {
+	Send(*WatchResponse) error
+	Context() context.Context
+}
+`
+	require.Equal(path+"/pb/server.proteus.go", ServerFileName(protos[0]))
+	build(t, dir, files)
+}
+
+func TestWriteServersInvalidConverter(t *testing.T) {
+	g := NewGenerator()
+	g.Converters = []string{"StringToEvent"}
+
+	p := &protobuf.Package{Path: "example.com/feed", GoPackage: "example.com/feed/pb;pb"}
+	err := g.WriteServers(new(bytes.Buffer), p)
+	require.NotNil(t, err)
+}
+
+func TestImportPath(t *testing.T) {
+	require := require.New(t)
+
+	f := newFile("pb", "rpc")
+	require.Equal("rpc2", f.importPath("github.com/src-d/proteus/rpc"))
+	require.Equal("rpc3", f.importPath("example.com/rpc"))
+	require.Equal("rpc2", f.importPath("github.com/src-d/proteus/rpc"))
+	require.Equal("yaml_v2", f.importPath("gopkg.in/yaml.v2"))
+}
+
+func TestGoCamelCase(t *testing.T) {
+	cases := map[string]string{
+		"user_id":       "UserId",
+		"result1":       "Result1",
+		"UserStoreGet":  "UserStoreGet",
+		"_private":      "XPrivate",
+		"users_service": "UsersService",
+		"http2_code":    "Http2Code",
+		"foo.bar_baz":   "FooBarBaz",
+		"users.V2":      "Users_V2",
+	}
+
+	for name, expected := range cases {
+		require.Equal(t, expected, goCamelCase(name), name)
+	}
+}
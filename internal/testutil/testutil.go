@@ -0,0 +1,44 @@
+// Package testutil contains helpers shared by the tests of several
+// packages.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/proteus/report"
+	"github.com/src-d/proteus/resolver"
+	"github.com/src-d/proteus/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+// Project is the import path of the project.
+const Project = "github.com/src-d/proteus"
+
+// ProjectPath returns the path of the given package of the project inside
+// the GOPATH.
+func ProjectPath(pkg string) string {
+	return filepath.Join(os.Getenv("GOPATH"), "src", Project, pkg)
+}
+
+// Scan scans the packages in the given paths, reading the given files,
+// indexed by path, before reading them from disk, and resolves them. The
+// diagnostics are discarded.
+func Scan(t *testing.T, files map[string]string, paths ...string) resolver.Packages {
+	overlay := make(map[string][]byte, len(files))
+	for path, content := range files {
+		overlay[path] = []byte(content)
+	}
+
+	sc, err := scanner.NewWithOverlay(overlay, paths...)
+	require.Nil(t, err)
+	sc.Reporter = report.Discard
+	pkgs, err := sc.Scan()
+	require.Nil(t, err)
+
+	r := resolver.New()
+	r.Reporter = report.Discard
+	r.Resolve(resolver.Packages(pkgs))
+	return resolver.Packages(pkgs)
+}
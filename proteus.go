@@ -1 +1,173 @@
+// Package proteus ties together the scanning and resolution of Go
+// packages according to a configuration.
 package proteus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/src-d/proteus/protobuf"
+	"github.com/src-d/proteus/report"
+	"github.com/src-d/proteus/resolver"
+	"github.com/src-d/proteus/scanner"
+)
+
+// Config is the configuration of proteus, usually loaded from a JSON file
+// with LoadConfig.
+type Config struct {
+	// Paths are the directories of the packages to scan.
+	Paths []string `json:"paths"`
+	// Platforms are the build configurations used to scan the packages.
+	// See scanner.Scanner.Platforms.
+	Platforms []Platform `json:"platforms,omitempty"`
+	// Include contains the patterns of the types that will be included,
+	// along with the types of their package they reference.
+	// See scanner.TypeFilter for the syntax of the patterns.
+	Include []string `json:"include,omitempty"`
+	// Exclude contains the patterns of the types that will be excluded.
+	// See scanner.TypeFilter for the syntax of the patterns.
+	Exclude []string `json:"exclude,omitempty"`
+	// Follow contains the import path prefixes of the packages that will
+	// be scanned on demand when they are referenced by scanned types. See
+	// scanner.Scanner.Follow.
+	Follow []string `json:"follow,omitempty"`
+	// Types contains the mappings of named types of packages that are not
+	// scanned, indexed by their qualified name, e.g. `net/url.URL`.
+	Types map[string]TypeMapping `json:"types,omitempty"`
+	// IgnoreMarshalers disables the automatic mapping of types that
+	// implement the marshaling interfaces of the encoding package. See
+	// resolver.Resolver.IgnoreMarshalers.
+	IgnoreMarshalers bool `json:"ignore_marshalers,omitempty"`
+	// GoPackages contains the go_package options of the generated
+	// protobuf packages, indexed by the import path of their Go package.
+	// See protobuf.Transformer.GoPackages.
+	GoPackages map[string]string `json:"go_packages,omitempty"`
+	// Strict turns all the warnings into errors, which make the
+	// generation fail.
+	Strict bool `json:"strict,omitempty"`
+	// Severity contains the action for the diagnostics of some codes,
+	// which is either `error`, `warn` or `ignore`, e.g.
+	// `{"removed-field": "error"}`. It takes precedence over Strict.
+	Severity map[string]string `json:"severity,omitempty"`
+}
+
+// Platform is the configuration of a build platform.
+type Platform struct {
+	GOOS   string   `json:"goos,omitempty"`
+	GOARCH string   `json:"goarch,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// TypeMapping is the configuration of the mapping of a named type. See
+// resolver.TypeMapping.
+type TypeMapping struct {
+	// Type is the type used in the schema. It is either the name of a
+	// basic type, such as `string`, or the qualified name of a named type,
+	// such as `time.Time`, optionally prefixed by `[]` if it is repeated.
+	Type string `json:"type"`
+	// Encode and Decode are the optional qualified names of the functions
+	// converting a value of the named type into a value of Type and back,
+	// which are registered as converters by the generated Go code.
+	Encode string `json:"encode,omitempty"`
+	Decode string `json:"decode,omitempty"`
+}
+
+// LoadConfig reads the configuration in the JSON file at the given path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Config
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+
+	return &c, nil
+}
+
+// Scanner returns a new scanner configured with the current config.
+func (c *Config) Scanner() (*scanner.Scanner, error) {
+	s, err := scanner.New(c.Paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range c.Platforms {
+		s.Platforms = append(s.Platforms, scanner.Platform{
+			GOOS:   p.GOOS,
+			GOARCH: p.GOARCH,
+			Tags:   p.Tags,
+		})
+	}
+
+	s.Follow = c.Follow
+
+	if len(c.Include) > 0 || len(c.Exclude) > 0 {
+		s.Filter, err = scanner.NewTypeFilter(c.Include, c.Exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Resolver returns a new resolver configured with the current config.
+func (c *Config) Resolver() (*resolver.Resolver, error) {
+	r := resolver.New()
+	r.IgnoreMarshalers = c.IgnoreMarshalers
+	for name, m := range c.Types {
+		typ, err := parseType(m.Type)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping for type %s: %s", name, err)
+		}
+
+		r.Register(name, resolver.TypeMapping{
+			Type:   typ,
+			Encode: m.Encode,
+			Decode: m.Decode,
+		})
+	}
+
+	return r, nil
+}
+
+// Transformer returns a new transformer configured with the current
+// config.
+func (c *Config) Transformer() *protobuf.Transformer {
+	t := protobuf.NewTransformer()
+	t.GoPackages = c.GoPackages
+	return t
+}
+
+// Policy returns the policy deciding the severity of the diagnostics
+// according to the current config.
+func (c *Config) Policy() (*report.Policy, error) {
+	return report.NewPolicy(c.Strict, c.Severity)
+}
+
+func parseType(s string) (scanner.Type, error) {
+	repeated := strings.HasPrefix(s, "[]")
+	s = strings.TrimPrefix(s, "[]")
+	if s == "" {
+		return nil, fmt.Errorf("type can not be empty")
+	}
+
+	var typ scanner.Type
+	if idx := strings.LastIndex(s, "."); idx >= 0 {
+		if idx == 0 || idx == len(s)-1 || strings.LastIndex(s, "/") > idx {
+			return nil, fmt.Errorf("invalid named type %q", s)
+		}
+		typ = scanner.NewNamed(s[:idx], s[idx+1:])
+	} else {
+		typ = scanner.NewBasic(s)
+	}
+
+	typ.SetRepeated(repeated)
+	return typ, nil
+}
@@ -0,0 +1,171 @@
+package proteus
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/proteus/internal/testutil"
+	"github.com/src-d/proteus/report"
+	"github.com/src-d/proteus/resolver"
+	"github.com/src-d/proteus/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	require := require.New(t)
+
+	cfg := writeConfig(t, `{
+	"paths": ["`+testutil.ProjectPath("fixtures")+`"],
+	"platforms": [{"goos": "linux", "goarch": "amd64", "tags": ["foo"]}],
+	"exclude": ["Qux", "/^B/"]
+}`)
+
+	c, err := LoadConfig(cfg)
+	require.Nil(err)
+	require.Equal([]string{testutil.ProjectPath("fixtures")}, c.Paths)
+	require.Equal([]Platform{{"linux", "amd64", []string{"foo"}}}, c.Platforms)
+
+	s, err := c.Scanner()
+	require.Nil(err)
+
+	pkgs, err := s.Scan()
+	require.Nil(err)
+	require.Equal(1, len(pkgs))
+	require.Equal(1, len(pkgs[0].Structs))
+	require.Equal("Foo", pkgs[0].Structs[0].Name)
+	require.Equal(0, len(pkgs[0].Enums))
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, `{"paths": 1}`))
+	require.NotNil(t, err)
+
+	c, err := LoadConfig(writeConfig(t, `{"include": ["/(/"]}`))
+	require.Nil(t, err)
+	_, err = c.Scanner()
+	require.NotNil(t, err)
+}
+
+func TestConfigResolver(t *testing.T) {
+	require := require.New(t)
+
+	c, err := LoadConfig(writeConfig(t, `{
+	"paths": ["`+testutil.ProjectPath("fixtures")+`"],
+	"types": {
+		"net/url.URL": {"type": "string", "encode": "net/url.URL.String", "decode": "net/url.Parse"},
+		"github.com/google/uuid.UUID": {"type": "[]byte"}
+	},
+	"ignore_marshalers": true
+}`))
+	require.Nil(err)
+
+	r, err := c.Resolver()
+	require.Nil(err)
+	require.True(r.IgnoreMarshalers)
+	require.Equal(&resolver.TypeMapping{
+		Type:   scanner.NewBasic("string"),
+		Encode: "net/url.URL.String",
+		Decode: "net/url.Parse",
+	}, r.Mapping("net/url.URL"))
+
+	typ := scanner.NewBasic("byte")
+	typ.SetRepeated(true)
+	require.Equal(&resolver.TypeMapping{Type: typ}, r.Mapping("github.com/google/uuid.UUID"))
+}
+
+func TestConfigTransformer(t *testing.T) {
+	c, err := LoadConfig(writeConfig(t, `{
+	"go_packages": {"github.com/foo/users": "github.com/foo/users/userspb;userspb"}
+}`))
+	require.Nil(t, err)
+
+	tr := c.Transformer()
+	require.Equal(t, map[string]string{
+		"github.com/foo/users": "github.com/foo/users/userspb;userspb",
+	}, tr.GoPackages)
+}
+
+func TestConfigPolicy(t *testing.T) {
+	require := require.New(t)
+
+	c, err := LoadConfig(writeConfig(t, `{
+	"strict": true,
+	"severity": {"removed-field": "ignore", "map-as-list": "error"}
+}`))
+	require.Nil(err)
+
+	p, err := c.Policy()
+	require.Nil(err)
+	require.True(p.Strict)
+	require.Equal(map[report.Code]report.Action{
+		report.RemovedField: report.ActionIgnore,
+		report.MapAsList:    report.ActionError,
+	}, p.Overrides)
+
+	c.Severity = map[string]string{"removed-field": "fatal"}
+	_, err = c.Policy()
+	require.NotNil(err)
+
+	c.Severity = map[string]string{"no-such-code": "warn"}
+	_, err = c.Policy()
+	require.NotNil(err)
+}
+
+func TestConfigConverters(t *testing.T) {
+	c, err := LoadConfig(writeConfig(t, `{
+	"types": {
+		"github.com/google/uuid.UUID": {
+			"type": "string",
+			"encode": "github.com/foo/conv.UUIDToString",
+			"decode": "github.com/foo/conv.StringToUUID"
+		},
+		"net/url.URL": {"type": "string", "decode": "github.com/foo/conv.ParseURL"},
+		"math/big.Int": {"type": "string"}
+	}
+}`))
+	require.Nil(t, err)
+
+	r, err := c.Resolver()
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"github.com/foo/conv.ParseURL",
+		"github.com/foo/conv.StringToUUID",
+		"github.com/foo/conv.UUIDToString",
+	}, r.Converters())
+}
+
+func TestParseType(t *testing.T) {
+	cases := []struct {
+		typ      string
+		expected scanner.Type
+	}{
+		{"string", scanner.NewBasic("string")},
+		{"time.Time", scanner.NewNamed("time", "Time")},
+		{"github.com/foo/bar.Baz", scanner.NewNamed("github.com/foo/bar", "Baz")},
+		{"", nil},
+		{"[]", nil},
+		{"foo.", nil},
+		{".Foo", nil},
+		{"foo.bar/baz", nil},
+	}
+
+	for _, c := range cases {
+		typ, err := parseType(c.typ)
+		if c.expected == nil {
+			require.NotNil(t, err, c.typ)
+		} else {
+			require.Nil(t, err, c.typ)
+			require.Equal(t, c.expected, typ, c.typ)
+		}
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "proteus")
+	require.Nil(t, err)
+
+	path := filepath.Join(dir, "proteus.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
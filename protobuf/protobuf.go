@@ -0,0 +1,158 @@
+// Package protobuf contains the representation of the protobuf definitions
+// generated from resolved packages and the means to write them as .proto
+// files.
+package protobuf
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/src-d/proteus/scanner"
+)
+
+// Package is a protobuf package generated from a Go package.
+type Package struct {
+	// Name is the name of the protobuf package.
+	Name string
+	// Path is the import path of the Go package.
+	Path string
+	// GoPackage is the import path of the Go package where the code
+	// generated from the protobuf package lives.
+	GoPackage string
+	// Imports are the paths of the imported .proto files.
+	Imports  []string
+	Messages []*Message
+	Enums    []*Enum
+	Services []*Service
+}
+
+// FileName returns the path of the .proto file of the package, relative
+// to the directory of all the generated files.
+func (p *Package) FileName() string {
+	return path.Join(strings.TrimPrefix(p.Path, "/"), "generated.proto")
+}
+
+// Message returns the top level message with the given name or nil if
+// there is none.
+func (p *Package) Message(name string) *Message {
+	for _, m := range p.Messages {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Service returns the service with the given name or nil if there is
+// none.
+func (p *Package) Service(name string) *Service {
+	for _, s := range p.Services {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (p *Package) addImport(imp string) {
+	for _, i := range p.Imports {
+		if i == imp {
+			return
+		}
+	}
+	p.Imports = append(p.Imports, imp)
+}
+
+// Message is a protobuf message.
+type Message struct {
+	Name     string
+	Fields   []*Field
+	Messages []*Message
+}
+
+// Field is a field of a message.
+type Field struct {
+	Name     string
+	Number   int
+	Type     Type
+	Repeated bool
+}
+
+// Type is the type of a field.
+type Type interface {
+	fmt.Stringer
+	isType()
+}
+
+// Scalar is a protobuf scalar type, such as `int64` or `bytes`.
+type Scalar string
+
+func (s Scalar) String() string { return string(s) }
+func (Scalar) isType()          {}
+
+// Named is a message or enum type.
+type Named struct {
+	// Package is the name of the protobuf package of the type or empty if
+	// it is in the same package where it is used.
+	Package string
+	Name    string
+}
+
+func (n *Named) String() string {
+	if n.Package == "" {
+		return n.Name
+	}
+	return fmt.Sprintf(".%s.%s", n.Package, n.Name)
+}
+func (*Named) isType() {}
+
+// Map is a map type.
+type Map struct {
+	Key   Scalar
+	Value Type
+}
+
+func (m *Map) String() string {
+	return fmt.Sprintf("map<%s, %s>", m.Key, m.Value)
+}
+func (*Map) isType() {}
+
+// Enum is a protobuf enum.
+type Enum struct {
+	Name   string
+	Values []*EnumValue
+	// AllowAlias is whether several values have the same number.
+	AllowAlias bool
+}
+
+// EnumValue is a value of an enum.
+type EnumValue struct {
+	Name   string
+	Number int
+}
+
+// Service is a protobuf service.
+type Service struct {
+	Name string
+	RPCs []*RPC
+	// Receiver is the type whose methods are the RPCs of the service or
+	// nil if they are the functions of the package.
+	Receiver *scanner.Receiver
+}
+
+// RPC is a method of a service.
+type RPC struct {
+	Name   string
+	Input  string
+	Output string
+	// Func is the function or method the RPC is generated from. The fields
+	// of the input and output messages are its parameters and results, or
+	// its streams, in the same order.
+	Func *scanner.Func
+	// ClientStreaming and ServerStreaming report whether the client and
+	// the server, respectively, send a stream of messages instead of just
+	// one.
+	ClientStreaming bool
+	ServerStreaming bool
+}
@@ -0,0 +1,539 @@
+package protobuf
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/src-d/proteus/report"
+	"github.com/src-d/proteus/resolver"
+	"github.com/src-d/proteus/scanner"
+)
+
+// Transformer converts resolved packages into protobuf packages.
+type Transformer struct {
+	// Reporter receives the diagnostics about the types that can not be
+	// represented. If it is nil, report.Default is used.
+	Reporter report.Reporter
+	// GoPackages contains the go_package options of the protobuf packages,
+	// indexed by the import path of their Go package, e.g.
+	// `github.com/foo/bar/barpb;barpb`. Packages without one are generated
+	// in the `pb` package inside the directory of their Go package.
+	GoPackages map[string]string
+
+	// packages contains the names of the protobuf packages indexed by the
+	// import path of their Go package.
+	packages map[string]string
+}
+
+// NewTransformer returns a new transformer.
+func NewTransformer() *Transformer {
+	return &Transformer{}
+}
+
+// wellKnownTypes are the types of packages that are not scanned but have a
+// well known protobuf representation, indexed by qualified name.
+var wellKnownTypes = map[string]struct {
+	typ  *Named
+	file string
+}{
+	"time.Time":     {&Named{Package: "google.protobuf", Name: "Timestamp"}, "google/protobuf/timestamp.proto"},
+	"time.Duration": {&Named{Package: "google.protobuf", Name: "Duration"}, "google/protobuf/duration.proto"},
+}
+
+// scalars are the protobuf scalar types of the Go basic types.
+var scalars = map[string]Scalar{
+	"bool":    "bool",
+	"string":  "string",
+	"int":     "int64",
+	"int8":    "int32",
+	"int16":   "int32",
+	"int32":   "int32",
+	"int64":   "int64",
+	"rune":    "int32",
+	"uint":    "uint64",
+	"uint8":   "uint32",
+	"byte":    "uint32",
+	"uint16":  "uint32",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"uintptr": "uint64",
+	"float32": "float",
+	"float64": "double",
+}
+
+// Transform converts the given packages, which must be resolved, into
+// protobuf packages. Fields whose type can not be represented are left
+// out and reported.
+func (t *Transformer) Transform(pkgs resolver.Packages) []*Package {
+	t.packages = make(map[string]string, len(pkgs))
+	for _, p := range pkgs {
+		t.packages[p.Path] = ProtoPackage(p.Path)
+	}
+
+	var result = make([]*Package, 0, len(pkgs))
+	for _, p := range pkgs {
+		result = append(result, t.transformPackage(p))
+	}
+	return result
+}
+
+func (t *Transformer) reporter() report.Reporter {
+	if t.Reporter == nil {
+		return report.Default
+	}
+	return t.Reporter
+}
+
+func (t *Transformer) transformPackage(p *scanner.Package) *Package {
+	pkg := &Package{
+		Name:      t.packages[p.Path],
+		Path:      p.Path,
+		GoPackage: t.GoPackages[p.Path],
+	}
+	if pkg.GoPackage == "" {
+		pkg.GoPackage = p.Path + "/pb;pb"
+	}
+
+	for _, s := range p.Structs {
+		pkg.Messages = append(pkg.Messages, t.transformStruct(pkg, p, s, ""))
+	}
+
+	for _, e := range p.Enums {
+		pkg.Enums = append(pkg.Enums, t.transformEnum(p, e))
+	}
+
+	for _, funcs := range groupFuncs(p.Funcs) {
+		if svc := t.transformFuncs(pkg, p, funcs); svc != nil {
+			pkg.Services = append(pkg.Services, svc)
+		}
+	}
+
+	return pkg
+}
+
+// transformStruct converts the struct s, whose parent struct has the given
+// name if it is nested, into a message.
+func (t *Transformer) transformStruct(pkg *Package, p *scanner.Package, s *scanner.Struct, parent string) *Message {
+	msg := &Message{Name: strings.TrimPrefix(s.Name, parent+".")}
+	if parent == "" {
+		msg.Name = s.Name
+	}
+
+	msg.Fields = t.transformFields(pkg, p, s.Name, s.Fields)
+	for _, n := range s.Nested {
+		msg.Messages = append(msg.Messages, t.transformStruct(pkg, p, n, s.Name))
+	}
+	return msg
+}
+
+// transformFields converts the given fields of the struct or message with
+// the given name. Fields without name are named after their position.
+func (t *Transformer) transformFields(pkg *Package, p *scanner.Package, owner string, fields []*scanner.Field) []*Field {
+	var (
+		result  []*Field
+		numbers = t.fieldNumbers(p, owner, fields)
+	)
+	for i, f := range fields {
+		typ, repeated, err := t.transformType(pkg, f.Type)
+		if err != nil {
+			t.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.UnsupportedType,
+				Message:  fmt.Sprintf("field %q of %q of package %s can not be represented: %s", f.Name, owner, p.Path, err),
+				Pos:      f.Pos,
+				Type:     fmt.Sprintf("%s.%s", p.Path, owner),
+			})
+			continue
+		}
+
+		result = append(result, &Field{
+			Name:     ToSnakeCase(f.Name),
+			Number:   numbers[i],
+			Type:     typ,
+			Repeated: repeated,
+		})
+	}
+	return result
+}
+
+const (
+	maxFieldNumber     = 1<<29 - 1
+	firstReservedField = 19000
+	lastReservedField  = 19999
+)
+
+// fieldNumbers returns the numbers of the given fields of the struct or
+// message with the given name. Fields keep the number given with their
+// proto tag, unless it is invalid or taken by a previous field, which is
+// reported, and the rest get the lowest numbers not taken in order. Fields
+// that can not be represented take their numbers too, so leaving them out
+// does not change the numbers of the rest.
+func (t *Transformer) fieldNumbers(p *scanner.Package, owner string, fields []*scanner.Field) []int {
+	var (
+		numbers = make([]int, len(fields))
+		taken   = make(map[int]bool)
+	)
+	for i, f := range fields {
+		if f.Number == 0 {
+			continue
+		}
+
+		var problem string
+		switch {
+		case f.Number < 1 || f.Number > maxFieldNumber:
+			problem = fmt.Sprintf("is out of the range 1-%d", maxFieldNumber)
+		case f.Number >= firstReservedField && f.Number <= lastReservedField:
+			problem = fmt.Sprintf("is reserved, as the range %d-%d", firstReservedField, lastReservedField)
+		case taken[f.Number]:
+			problem = "is already taken"
+		}
+
+		if problem != "" {
+			t.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.InvalidFieldNumber,
+				Message:  fmt.Sprintf("number %d of field %q of %q of package %s %s", f.Number, f.Name, owner, p.Path, problem),
+				Pos:      f.Pos,
+				Type:     fmt.Sprintf("%s.%s", p.Path, owner),
+			})
+			continue
+		}
+
+		numbers[i] = f.Number
+		taken[f.Number] = true
+	}
+
+	next := 1
+	for i := range numbers {
+		if numbers[i] != 0 {
+			continue
+		}
+
+		for taken[next] {
+			next++
+		}
+		numbers[i] = next
+		taken[next] = true
+	}
+	return numbers
+}
+
+// transformType returns the protobuf type of the given type and whether
+// it is repeated.
+func (t *Transformer) transformType(pkg *Package, typ scanner.Type) (Type, bool, error) {
+	switch typ := typ.(type) {
+	case *scanner.Basic:
+		if typ.IsRepeated() && (typ.Name == "byte" || typ.Name == "uint8") {
+			return Scalar("bytes"), false, nil
+		}
+
+		s, ok := scalars[typ.Name]
+		if !ok {
+			return nil, false, fmt.Errorf("basic type %s is not supported", typ.Name)
+		}
+		return s, typ.IsRepeated(), nil
+	case *scanner.Named:
+		n, err := t.transformNamed(pkg, typ)
+		if err != nil {
+			return nil, false, err
+		}
+		return n, typ.IsRepeated(), nil
+	case *scanner.Map:
+		key, repeated, err := t.transformType(pkg, typ.Key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		s, ok := key.(Scalar)
+		if !ok || repeated || s == "bytes" || s == "float" || s == "double" {
+			return nil, false, fmt.Errorf("map key type %s is not supported", key)
+		}
+
+		val, repeated, err := t.transformType(pkg, typ.Value)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if _, ok := val.(*Map); ok || repeated {
+			return nil, false, fmt.Errorf("map value type %s is not supported", val)
+		}
+		return &Map{Key: s, Value: val}, typ.IsRepeated(), nil
+	}
+
+	return nil, false, fmt.Errorf("type is not supported")
+}
+
+func (t *Transformer) transformNamed(pkg *Package, n *scanner.Named) (*Named, error) {
+	if n.Path == pkg.Path {
+		return &Named{Name: n.Name}, nil
+	}
+
+	if name, ok := t.packages[n.Path]; ok {
+		pkg.addImport((&Package{Path: n.Path}).FileName())
+		return &Named{Package: name, Name: n.Name}, nil
+	}
+
+	if wk, ok := wellKnownTypes[n.String()]; ok {
+		pkg.addImport(wk.file)
+		return wk.typ, nil
+	}
+
+	return nil, fmt.Errorf("type %s has no protobuf representation", n)
+}
+
+// transformEnum converts the enum e of package p. Values are numbered
+// after their constants, or their position if they have no number, and
+// sorted by number. Values that do not fit in an int32 are left out and
+// reported. As protobuf enums must have a zero value, an unspecified one
+// is added if there is none, and enums with several values with the same
+// number allow aliases.
+func (t *Transformer) transformEnum(p *scanner.Package, e *scanner.Enum) *Enum {
+	var (
+		enum  = &Enum{Name: e.Name}
+		taken = make(map[int]bool)
+	)
+	for i, v := range e.Values {
+		n, ok := e.Numbers[v]
+		if !ok {
+			n = int64(i)
+		}
+
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			t.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.UnsupportedType,
+				Message:  fmt.Sprintf("value %s of enum %q of package %s does not fit in an int32", v, e.Name, p.Path),
+				Type:     fmt.Sprintf("%s.%s", p.Path, e.Name),
+			})
+			continue
+		}
+
+		if taken[int(n)] {
+			enum.AllowAlias = true
+		}
+		taken[int(n)] = true
+		enum.Values = append(enum.Values, &EnumValue{Name: v, Number: int(n)})
+	}
+
+	sort.SliceStable(enum.Values, func(i, j int) bool {
+		return enum.Values[i].Number < enum.Values[j].Number
+	})
+
+	if !taken[0] {
+		enum.Values = append([]*EnumValue{{Name: e.Name + "Unspecified"}}, enum.Values...)
+	}
+	return enum
+}
+
+// groupFuncs groups the given funcs by receiver, keeping the order in
+// which every receiver appears first. Functions are grouped together.
+func groupFuncs(funcs []*scanner.Func) [][]*scanner.Func {
+	var (
+		groups [][]*scanner.Func
+		index  = make(map[string]int)
+	)
+	for _, f := range funcs {
+		var recv string
+		if f.Receiver != nil {
+			recv = f.Receiver.Name
+		}
+
+		i, ok := index[recv]
+		if !ok {
+			i = len(groups)
+			index[recv] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], f)
+	}
+	return groups
+}
+
+// transformFuncs converts the given funcs, which all have the same
+// receiver, into a service with an RPC per func. Functions make up a
+// service named after the package and methods one named after their
+// receiver. The request and response messages of every RPC are named
+// after the func, prefixed by the receiver for methods. The messages of
+// streams have the streamed value as their only field. It returns nil if
+// the name of the service is already taken.
+func (t *Transformer) transformFuncs(pkg *Package, p *scanner.Package, funcs []*scanner.Func) *Service {
+	var (
+		recv   = funcs[0].Receiver
+		prefix string
+		svc    = &Service{Name: ToCamelCase(p.Name) + "Service", Receiver: recv}
+	)
+	if recv != nil {
+		prefix = recv.Name
+		svc.Name = recv.Name + "Service"
+	}
+
+	if pkg.Service(svc.Name) != nil {
+		name, pos := p.Name, funcs[0].Pos
+		if recv != nil {
+			name, pos = recv.Name, recv.Pos
+		}
+
+		t.reporter().Report(&report.Diagnostic{
+			Severity: report.Warning,
+			Code:     report.InvalidRPC,
+			Message:  fmt.Sprintf("the RPCs of %s will not be generated because there is already a service named %s", name, svc.Name),
+			Pos:      pos,
+			Type:     fmt.Sprintf("%s.%s", p.Path, name),
+		})
+		return nil
+	}
+
+	for _, f := range funcs {
+		rpc := &RPC{
+			Name:            f.Name,
+			Input:           prefix + f.Name + "Request",
+			Output:          prefix + f.Name + "Response",
+			Func:            f,
+			ClientStreaming: f.ClientStream != nil,
+			ServerStreaming: f.ServerStream != nil,
+		}
+
+		if !t.checkMessageNames(pkg, p, f, rpc.Input, rpc.Output) {
+			continue
+		}
+
+		params, results := f.Params, f.Results
+		if f.ClientStream != nil {
+			params = []*scanner.Field{f.ClientStream.Field}
+		}
+		if f.ServerStream != nil {
+			results = []*scanner.Field{f.ServerStream.Field}
+		}
+
+		input := t.transformParams(pkg, p, rpc.Input, params, "arg")
+		output := t.transformParams(pkg, p, rpc.Output, results, "result")
+		if len(input.Fields) != len(params) || len(output.Fields) != len(results) {
+			t.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.InvalidRPC,
+				Message:  fmt.Sprintf("function %s will not be an RPC because some of its parameters or results can not be represented", f.FullName()),
+				Pos:      f.Pos,
+				Type:     fmt.Sprintf("%s.%s", p.Path, f.FullName()),
+			})
+			continue
+		}
+
+		pkg.Messages = append(pkg.Messages, input, output)
+		svc.RPCs = append(svc.RPCs, rpc)
+	}
+	return svc
+}
+
+// checkMessageNames reports whether none of the given message names are
+// already taken in the package. If any of them is, it is reported.
+func (t *Transformer) checkMessageNames(pkg *Package, p *scanner.Package, f *scanner.Func, names ...string) bool {
+	for _, name := range names {
+		if pkg.Message(name) != nil {
+			t.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.InvalidRPC,
+				Message:  fmt.Sprintf("function %s will not be an RPC because there is already a message named %s", f.FullName(), name),
+				Pos:      f.Pos,
+				Type:     fmt.Sprintf("%s.%s", p.Path, f.FullName()),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// transformParams converts the given parameters or results into a message
+// with the given name. Those without name are named with the given prefix
+// and their position, or just the prefix if there is only one.
+func (t *Transformer) transformParams(pkg *Package, p *scanner.Package, name string, params []*scanner.Field, prefix string) *Message {
+	var fields = make([]*scanner.Field, len(params))
+	for i, f := range params {
+		fields[i] = &scanner.Field{Name: f.Name, Type: f.Type, Pos: f.Pos}
+		if f.Name == "" {
+			fields[i].Name = prefix
+			if len(params) > 1 {
+				fields[i].Name = fmt.Sprintf("%s%d", prefix, i+1)
+			}
+		}
+	}
+
+	return &Message{
+		Name:   name,
+		Fields: t.transformFields(pkg, p, name, fields),
+	}
+}
+
+// ProtoPackage returns the name of the protobuf package of the Go package
+// with the given import path, such as `github.com.foo.bar` for
+// `github.com/foo/bar`.
+func ProtoPackage(path string) string {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+
+		part = strings.Map(func(r rune) rune {
+			if r == '.' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return '_'
+		}, part)
+
+		for _, p := range strings.Split(part, ".") {
+			if p != "" && unicode.IsDigit(rune(p[0])) {
+				p = "_" + p
+			}
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ToSnakeCase converts a Go identifier into a protobuf field name, such as
+// `user_id` for `UserID`.
+func ToSnakeCase(name string) string {
+	var (
+		runes  = []rune(name)
+		result []rune
+	)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				result = append(result, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
+
+// ToCamelCase converts a Go identifier or package name into an upper camel
+// case name, such as `UserStore` for `user_store`.
+func ToCamelCase(name string) string {
+	var (
+		result []rune
+		upper  = true
+	)
+	for _, r := range name {
+		if r == '_' || r == '-' || r == '.' {
+			upper = true
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
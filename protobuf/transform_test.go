@@ -0,0 +1,428 @@
+package protobuf
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/src-d/proteus/internal/testutil"
+	"github.com/src-d/proteus/report"
+	"github.com/stretchr/testify/require"
+)
+
+// withoutFuncs returns copies of the given RPCs without their funcs, so
+// they can be compared.
+func withoutFuncs(rpcs []*RPC) []*RPC {
+	var result []*RPC
+	for _, r := range rpcs {
+		rpc := *r
+		rpc.Func = nil
+		result = append(result, &rpc)
+	}
+	return result
+}
+
+func TestTransform(t *testing.T) {
+	require := require.New(t)
+
+	users := testutil.ProjectPath("fixtures/overlay/users")
+	geo := testutil.ProjectPath("fixtures/overlay/geo")
+	pkgs := testutil.Scan(t, map[string]string{
+		filepath.Join(geo, "geo.go"): `package geo
+
+type Point struct {
+	Lat, Lng float64
+}
+`,
+		filepath.Join(users, "users.go"): `//proteus:service
+package users
+
+import (
+	"time"
+
+	"github.com/src-d/proteus/fixtures/overlay/geo"
+)
+
+type User struct {
+	UserID    uint64
+	Name      string
+	Avatar    []byte
+	Tags      map[string]int32
+	Location  *geo.Point
+	CreatedAt time.Time
+	Kind      Kind
+	Settings  struct {
+		Public bool
+	}
+	Complex   complex64
+}
+
+type Kind int
+
+const (
+	Admin Kind = iota
+	Member
+)
+
+func Find(name string, kind Kind) []User {
+	return nil
+}
+
+func Count() (int, bool) {
+	return 0, false
+}
+`,
+	}, users, geo)
+
+	var collector report.Collector
+	tr := NewTransformer()
+	tr.Reporter = &collector
+	protos := tr.Transform(pkgs)
+	require.Equal(2, len(protos))
+
+	require.Equal(1, len(collector.Diagnostics()))
+	require.Equal(report.UnsupportedType, collector.Diagnostics()[0].Code)
+
+	p := protos[0]
+	require.Equal("github.com.src_d.proteus.fixtures.overlay.users", p.Name)
+	require.Equal(testutil.Project+"/fixtures/overlay/users/generated.proto", p.FileName())
+	require.Equal([]string{
+		testutil.Project + "/fixtures/overlay/geo/generated.proto",
+		"google/protobuf/timestamp.proto",
+	}, p.Imports)
+
+	expected := `// Code generated by proteus. DO NOT EDIT.
+syntax = "proto3";
+
+package github.com.src_d.proteus.fixtures.overlay.users;
+
+import "github.com/src-d/proteus/fixtures/overlay/geo/generated.proto";
+import "google/protobuf/timestamp.proto";
+
+option go_package = "github.com/src-d/proteus/fixtures/overlay/users/pb;pb";
+
+message User {
+  uint64 user_id = 1;
+  string name = 2;
+  bytes avatar = 3;
+  map<string, int32> tags = 4;
+  .github.com.src_d.proteus.fixtures.overlay.geo.Point location = 5;
+  .google.protobuf.Timestamp created_at = 6;
+  Kind kind = 7;
+  User.Settings settings = 8;
+
+  message Settings {
+    bool public = 1;
+  }
+}
+
+message CountRequest {
+}
+
+message CountResponse {
+  int64 result1 = 1;
+  bool result2 = 2;
+}
+
+message FindRequest {
+  string name = 1;
+  Kind kind = 2;
+}
+
+message FindResponse {
+  repeated User result = 1;
+}
+
+enum Kind {
+  Admin = 0;
+  Member = 1;
+}
+
+service UsersService {
+  rpc Count (CountRequest) returns (CountResponse);
+  rpc Find (FindRequest) returns (FindResponse);
+}
+`
+	var buf bytes.Buffer
+	require.Nil(p.Write(&buf))
+	require.Equal(expected, buf.String())
+}
+
+func TestTransformNumbers(t *testing.T) {
+	require := require.New(t)
+
+	path := testutil.ProjectPath("fixtures/overlay/numbers")
+	pkgs := testutil.Scan(t, map[string]string{
+		filepath.Join(path, "numbers.go"): `package numbers
+
+type Item struct {
+	Name    string
+	ID      int64      ` + "`proto:\"1\"`" + `
+	Complex complex64
+	Price   float64    ` + "`proto:\"19500\"`" + `
+	Stock   int32      ` + "`proto:\"1\"`" + `
+	Color   Color
+}
+
+type Color int
+
+const (
+	Red   Color = 2
+	Green Color = 1
+	Blue  Color = 3
+	Cyan  Color = Blue
+	Huge  Color = 1 << 40
+)
+`,
+	}, path)
+
+	var collector report.Collector
+	tr := NewTransformer()
+	tr.Reporter = &collector
+	tr.GoPackages = map[string]string{
+		testutil.Project + "/fixtures/overlay/numbers": "example.com/numbers/numberspb;numberspb",
+	}
+	protos := tr.Transform(pkgs)
+
+	var codes []report.Code
+	for _, d := range collector.Diagnostics() {
+		codes = append(codes, d.Code)
+	}
+	require.Equal([]report.Code{
+		report.InvalidFieldNumber,
+		report.InvalidFieldNumber,
+		report.UnsupportedType,
+		report.UnsupportedType,
+	}, codes)
+
+	expected := `// Code generated by proteus. DO NOT EDIT.
+syntax = "proto3";
+
+package github.com.src_d.proteus.fixtures.overlay.numbers;
+
+option go_package = "example.com/numbers/numberspb;numberspb";
+
+message Item {
+  string name = 2;
+  int64 id = 1;
+  double price = 4;
+  int32 stock = 5;
+  Color color = 6;
+}
+
+enum Color {
+  option allow_alias = true;
+  ColorUnspecified = 0;
+  Green = 1;
+  Red = 2;
+  Blue = 3;
+  Cyan = 3;
+}
+`
+	var buf bytes.Buffer
+	require.Nil(protos[0].Write(&buf))
+	require.Equal(expected, buf.String())
+}
+
+func TestTransformMessageNameConflict(t *testing.T) {
+	path := testutil.ProjectPath("fixtures/overlay/conflict")
+	pkgs := testutil.Scan(t, map[string]string{
+		filepath.Join(path, "conflict.go"): `//proteus:service
+package conflict
+
+type GetRequest struct {
+	ID int
+}
+
+func Get(id int) int {
+	return id
+}
+`,
+	}, path)
+
+	var collector report.Collector
+	tr := NewTransformer()
+	tr.Reporter = &collector
+	protos := tr.Transform(pkgs)
+
+	require.Equal(t, 0, len(protos[0].Services[0].RPCs))
+	require.Equal(t, 1, len(protos[0].Messages))
+	require.Equal(t, report.InvalidRPC, collector.Diagnostics()[0].Code)
+}
+
+func TestTransformUnrepresentableParams(t *testing.T) {
+	path := testutil.ProjectPath("fixtures/overlay/complex")
+	pkgs := testutil.Scan(t, map[string]string{
+		filepath.Join(path, "complex.go"): `//proteus:service
+package complex
+
+func Abs(c complex128) float64 {
+	return 0
+}
+`,
+	}, path)
+
+	var collector report.Collector
+	tr := NewTransformer()
+	tr.Reporter = &collector
+	protos := tr.Transform(pkgs)
+
+	require.Equal(t, 0, len(protos[0].Services[0].RPCs))
+	require.Equal(t, 0, len(protos[0].Messages))
+
+	var codes []report.Code
+	for _, d := range collector.Diagnostics() {
+		codes = append(codes, d.Code)
+	}
+	require.Equal(t, []report.Code{report.UnsupportedType, report.InvalidRPC}, codes)
+}
+
+func TestTransformMethods(t *testing.T) {
+	require := require.New(t)
+
+	path := testutil.ProjectPath("fixtures/overlay/store")
+	pkgs := testutil.Scan(t, map[string]string{
+		filepath.Join(path, "store.go"): `//proteus:service
+package store
+
+type User struct {
+	Name string
+}
+
+//proteus:service
+type UserStore struct{}
+
+func (s *UserStore) Get(id int64) *User {
+	return nil
+}
+
+func (s *UserStore) Count() int64 {
+	return 0
+}
+
+//proteus:service
+type Store struct{}
+
+func (Store) Ping() {}
+
+func Get(id int64) *User {
+	return nil
+}
+`,
+	}, path)
+
+	var collector report.Collector
+	tr := NewTransformer()
+	tr.Reporter = &collector
+	p := tr.Transform(pkgs)[0]
+
+	var services []string
+	for _, s := range p.Services {
+		services = append(services, s.Name)
+	}
+	require.Equal([]string{"StoreService", "UserStoreService"}, services)
+
+	require.Equal([]*RPC{
+		{Name: "Count", Input: "UserStoreCountRequest", Output: "UserStoreCountResponse"},
+		{Name: "Get", Input: "UserStoreGetRequest", Output: "UserStoreGetResponse"},
+	}, withoutFuncs(p.Service("UserStoreService").RPCs))
+	require.Equal("UserStore", p.Service("UserStoreService").Receiver.Name)
+	require.Equal("UserStore.Count", p.Service("UserStoreService").RPCs[0].Func.FullName())
+	require.Equal([]*RPC{
+		{Name: "Get", Input: "GetRequest", Output: "GetResponse"},
+	}, withoutFuncs(p.Service("StoreService").RPCs))
+	require.Nil(p.Service("StoreService").Receiver)
+
+	require.NotNil(p.Message("UserStoreGetRequest"))
+	require.Equal("id", p.Message("UserStoreGetRequest").Fields[0].Name)
+
+	require.Equal(1, len(collector.Diagnostics()))
+	require.Equal(report.InvalidRPC, collector.Diagnostics()[0].Code)
+	require.Equal(testutil.Project+"/fixtures/overlay/store.Store", collector.Diagnostics()[0].Type)
+}
+
+func TestTransformStreams(t *testing.T) {
+	require := require.New(t)
+
+	path := testutil.ProjectPath("fixtures/overlay/feed")
+	pkgs := testutil.Scan(t, map[string]string{
+		filepath.Join(path, "feed.go"): `//proteus:service
+package feed
+
+import "context"
+
+type Event struct {
+	Name string
+}
+
+func Watch(ctx context.Context, topic string, events chan<- Event) error {
+	return nil
+}
+
+func Publish(ctx context.Context, events <-chan Event) (int64, error) {
+	return 0, nil
+}
+
+func Chat(in <-chan string) <-chan string {
+	return nil
+}
+`,
+	}, path)
+
+	p := NewTransformer().Transform(pkgs)[0]
+	require.Equal([]*RPC{
+		{Name: "Chat", Input: "ChatRequest", Output: "ChatResponse", ClientStreaming: true, ServerStreaming: true},
+		{Name: "Publish", Input: "PublishRequest", Output: "PublishResponse", ClientStreaming: true},
+		{Name: "Watch", Input: "WatchRequest", Output: "WatchResponse", ServerStreaming: true},
+	}, withoutFuncs(p.Services[0].RPCs))
+
+	require.Equal([]*Field{
+		{Name: "topic", Number: 1, Type: Scalar("string")},
+	}, p.Message("WatchRequest").Fields)
+	require.Equal([]*Field{
+		{Name: "events", Number: 1, Type: &Named{Name: "Event"}},
+	}, p.Message("WatchResponse").Fields)
+	require.Equal([]*Field{
+		{Name: "result", Number: 1, Type: Scalar("int64")},
+	}, p.Message("PublishResponse").Fields)
+
+	var buf bytes.Buffer
+	require.Nil(p.Write(&buf))
+	require.Contains(buf.String(), `service FeedService {
+  rpc Chat (stream ChatRequest) returns (stream ChatResponse);
+  rpc Publish (stream PublishRequest) returns (PublishResponse);
+  rpc Watch (WatchRequest) returns (stream WatchResponse);
+}
+`)
+}
+
+func TestProtoPackage(t *testing.T) {
+	cases := map[string]string{
+		"github.com/src-d/proteus": "github.com.src_d.proteus",
+		"/tmp/foo-bar/baz":         "tmp.foo_bar.baz",
+		"gopkg.in/yaml.v2":         "gopkg.in.yaml.v2",
+		"example.com/1st":          "example.com._1st",
+	}
+
+	for path, expected := range cases {
+		require.Equal(t, expected, ProtoPackage(path), path)
+	}
+}
+
+func TestNameCases(t *testing.T) {
+	snake := map[string]string{
+		"ID":        "id",
+		"UserID":    "user_id",
+		"HTTPCode":  "http_code",
+		"createdAt": "created_at",
+		"Lat":       "lat",
+		"Arg2":      "arg2",
+		"V2Name":    "v2_name",
+	}
+	for name, expected := range snake {
+		require.Equal(t, expected, ToSnakeCase(name), name)
+	}
+
+	require.Equal(t, "UserStore", ToCamelCase("user_store"))
+	require.Equal(t, "Users", ToCamelCase("users"))
+}
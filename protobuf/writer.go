@@ -0,0 +1,138 @@
+package protobuf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Write writes the package as a .proto file.
+func (p *Package) Write(w io.Writer) error {
+	pw := &printer{}
+	pw.line("// Code generated by proteus. DO NOT EDIT.")
+	pw.line(`syntax = "proto3";`)
+	pw.line("")
+	pw.line("package %s;", p.Name)
+
+	if len(p.Imports) > 0 {
+		pw.line("")
+		for _, imp := range p.Imports {
+			pw.line("import %q;", imp)
+		}
+	}
+
+	if p.GoPackage != "" {
+		pw.line("")
+		pw.line("option go_package = %q;", p.GoPackage)
+	}
+
+	for _, m := range p.Messages {
+		pw.line("")
+		pw.message(m)
+	}
+
+	for _, e := range p.Enums {
+		pw.line("")
+		pw.enum(e)
+	}
+
+	for _, s := range p.Services {
+		pw.line("")
+		pw.service(s)
+	}
+
+	_, err := io.WriteString(w, pw.String())
+	return err
+}
+
+// Generate writes the .proto files of the given packages in the given
+// directory, each one at the path returned by its FileName method.
+func Generate(pkgs []*Package, dir string) error {
+	for _, p := range pkgs {
+		path := filepath.Join(dir, filepath.FromSlash(p.FileName()))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		if err := p.Write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("unable to write %s: %s", path, err)
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type printer struct {
+	strings.Builder
+	indent int
+}
+
+func (p *printer) line(format string, args ...interface{}) {
+	if format != "" {
+		p.WriteString(strings.Repeat("  ", p.indent))
+		fmt.Fprintf(p, format, args...)
+	}
+	p.WriteString("\n")
+}
+
+func (p *printer) message(m *Message) {
+	p.line("message %s {", m.Name)
+	p.indent++
+	for _, f := range m.Fields {
+		if f.Repeated {
+			p.line("repeated %s %s = %d;", f.Type, f.Name, f.Number)
+		} else {
+			p.line("%s %s = %d;", f.Type, f.Name, f.Number)
+		}
+	}
+
+	for i, n := range m.Messages {
+		if i > 0 || len(m.Fields) > 0 {
+			p.line("")
+		}
+		p.message(n)
+	}
+	p.indent--
+	p.line("}")
+}
+
+func (p *printer) enum(e *Enum) {
+	p.line("enum %s {", e.Name)
+	p.indent++
+	if e.AllowAlias {
+		p.line("option allow_alias = true;")
+	}
+	for _, v := range e.Values {
+		p.line("%s = %d;", v.Name, v.Number)
+	}
+	p.indent--
+	p.line("}")
+}
+
+func (p *printer) service(s *Service) {
+	p.line("service %s {", s.Name)
+	p.indent++
+	for _, r := range s.RPCs {
+		p.line("rpc %s (%s) returns (%s);", r.Name, streamed(r.Input, r.ClientStreaming), streamed(r.Output, r.ServerStreaming))
+	}
+	p.indent--
+	p.line("}")
+}
+
+func streamed(msg string, stream bool) string {
+	if stream {
+		return "stream " + msg
+	}
+	return msg
+}
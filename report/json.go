@@ -0,0 +1,57 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSON is a reporter writing every diagnostic as a JSON object in its own
+// line, as soon as it is reported.
+type JSON struct {
+	mut sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSON returns a new JSON-lines reporter writing to the given writer.
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{enc: json.NewEncoder(w)}
+}
+
+type jsonDiagnostic struct {
+	Severity string `json:"severity"`
+	Code     Code   `json:"code,omitempty"`
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+// Report implements the Reporter interface. Write errors are kept and
+// returned by Err.
+func (j *JSON) Report(d *Diagnostic) {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+
+	err := j.enc.Encode(jsonDiagnostic{
+		Severity: d.Severity.String(),
+		Code:     d.Code,
+		Message:  d.Message,
+		File:     d.Pos.Filename,
+		Line:     d.Pos.Line,
+		Column:   d.Pos.Column,
+		Type:     d.Type,
+	})
+	if err != nil && j.err == nil {
+		j.err = err
+	}
+}
+
+// Err returns the first error found writing the diagnostics, if any.
+func (j *JSON) Err() error {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	return j.err
+}
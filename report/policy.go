@@ -0,0 +1,129 @@
+package report
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Action is what is done with the diagnostics of a code, overriding their
+// severity.
+type Action string
+
+const (
+	// ActionError turns the diagnostics into errors.
+	ActionError Action = "error"
+	// ActionWarn turns the diagnostics into warnings.
+	ActionWarn Action = "warn"
+	// ActionIgnore drops the diagnostics.
+	ActionIgnore Action = "ignore"
+)
+
+// Policy decides the final severity of the diagnostics, so warnings can
+// make the generation fail or be silenced.
+type Policy struct {
+	// Strict turns all the warnings into errors.
+	Strict bool
+	// Overrides contains the actions for the diagnostics of some codes,
+	// which take precedence over Strict.
+	Overrides map[Code]Action
+}
+
+// NewPolicy returns a new policy with the given overrides, which map
+// diagnostic codes to the names of actions. An error is returned if any
+// of the codes or actions is unknown.
+func NewPolicy(strict bool, overrides map[string]string) (*Policy, error) {
+	p := &Policy{Strict: strict, Overrides: make(map[Code]Action)}
+	for code, action := range overrides {
+		if _, ok := descriptions[Code(code)]; !ok {
+			return nil, fmt.Errorf("unknown diagnostic code %q", code)
+		}
+
+		switch a := Action(action); a {
+		case ActionError, ActionWarn, ActionIgnore:
+			p.Overrides[Code(code)] = a
+		default:
+			return nil, fmt.Errorf("invalid action %q for diagnostic code %q, it must be error, warn or ignore", action, code)
+		}
+	}
+
+	return p, nil
+}
+
+// apply returns the diagnostic with its final severity or nil if it has to
+// be dropped. The given diagnostic is never modified.
+func (p *Policy) apply(d *Diagnostic) *Diagnostic {
+	var severity = d.Severity
+	switch p.Overrides[d.Code] {
+	case ActionError:
+		severity = Error
+	case ActionWarn:
+		severity = Warning
+	case ActionIgnore:
+		return nil
+	default:
+		if p.Strict && severity == Warning {
+			severity = Error
+		}
+	}
+
+	if severity == d.Severity {
+		return d
+	}
+
+	result := *d
+	result.Severity = severity
+	return &result
+}
+
+// Reporter returns a reporter applying the policy to the diagnostics
+// before passing them to the given reporter.
+func (p *Policy) Reporter(r Reporter) *Enforcer {
+	return &Enforcer{policy: p, reporter: r}
+}
+
+// Enforcer is a reporter applying a policy to the diagnostics and keeping
+// count of the resulting errors.
+type Enforcer struct {
+	policy   *Policy
+	reporter Reporter
+
+	mut    sync.Mutex
+	errors int
+	// codes contains the number of errors of every code.
+	codes map[Code]int
+}
+
+// Report implements the Reporter interface.
+func (e *Enforcer) Report(d *Diagnostic) {
+	d = e.policy.apply(d)
+	if d == nil {
+		return
+	}
+
+	if d.Severity == Error {
+		e.mut.Lock()
+		e.errors++
+		if e.codes == nil {
+			e.codes = make(map[Code]int)
+		}
+		e.codes[d.Code]++
+		e.mut.Unlock()
+	}
+
+	e.reporter.Report(d)
+}
+
+// Errors returns the number of errors reported so far.
+func (e *Enforcer) Errors() int {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	return e.errors
+}
+
+// CodeErrors returns the number of errors with the given code reported so
+// far.
+func (e *Enforcer) CodeErrors(code Code) int {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	return e.codes[code]
+}
@@ -0,0 +1,45 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := NewPolicy(true, map[string]string{
+		string(RemovedField):   "ignore",
+		string(MapAsList):      "warn",
+		string(RemovalSummary): "error",
+	})
+	require.Nil(t, err)
+
+	var c Collector
+	e := p.Reporter(&c)
+
+	removed := &Diagnostic{Severity: Warning, Code: RemovedField}
+	unsupported := &Diagnostic{Severity: Warning, Code: UnsupportedType}
+	e.Report(removed)
+	e.Report(unsupported)
+	e.Report(&Diagnostic{Severity: Warning, Code: MapAsList})
+	e.Report(&Diagnostic{Severity: Info, Code: RemovalSummary})
+	e.Report(&Diagnostic{Severity: Info})
+
+	var severities []Severity
+	for _, d := range c.Diagnostics() {
+		severities = append(severities, d.Severity)
+	}
+	require.Equal(t, []Severity{Error, Warning, Error, Info}, severities)
+	require.Equal(t, 2, e.Errors())
+	require.Equal(t, 1, e.CodeErrors(RemovalSummary))
+	require.Equal(t, 0, e.CodeErrors(MapAsList))
+	require.Equal(t, Warning, unsupported.Severity, "reported diagnostics must not be modified")
+}
+
+func TestNewPolicyInvalid(t *testing.T) {
+	_, err := NewPolicy(false, map[string]string{"foo": "ignore"})
+	require.NotNil(t, err)
+
+	_, err = NewPolicy(false, map[string]string{string(RemovedField): "silence"})
+	require.NotNil(t, err)
+}
@@ -1,25 +1,228 @@
+// Package report defines the diagnostics emitted while scanning and
+// resolving packages and the reporters that collect them.
 package report
 
 import (
 	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"sync"
 
 	"github.com/fatih/color"
 )
 
+// Severity is the severity of a diagnostic.
+type Severity int
+
+const (
+	// Info diagnostics are merely informative.
+	Info Severity = iota
+	// Warning diagnostics describe something that may not be intended,
+	// such as a field being removed from the schema.
+	Warning
+	// Error diagnostics describe something that prevents the schema from
+	// being generated.
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// Code identifies the kind of a diagnostic. Codes are stable, so they can
+// be used to filter diagnostics.
+type Code string
+
+const (
+	// UnsupportedType is reported when a type can not be represented.
+	UnsupportedType Code = "unsupported-type"
+	// DuplicateField is reported when a struct has two fields with the
+	// same name, usually because of an embedded struct.
+	DuplicateField Code = "duplicate-field"
+	// InvalidEmbedded is reported when an embedded field is not a struct.
+	InvalidEmbedded Code = "invalid-embedded"
+	// UnscannedPackage is reported when a followed package can not be
+	// scanned.
+	UnscannedPackage Code = "unscanned-package"
+	// RemovedField is reported when a field is removed from the schema.
+	RemovedField Code = "removed-field"
+	// RemovedStruct is reported when a struct is removed from the schema.
+	RemovedStruct Code = "removed-struct"
+	// MapAsList is reported when a map can not be represented as such and
+	// is represented as a list of entries instead.
+	MapAsList Code = "map-as-list"
+	// RemovalSummary is reported with the number of removed fields and
+	// structs after resolving the packages.
+	RemovalSummary Code = "removal-summary"
+	// UnusedSuppression is reported when an ignore directive does not
+	// suppress any diagnostic.
+	UnusedSuppression Code = "unused-suppression"
+	// InvalidRPC is reported when a function can not be exposed as an
+	// RPC.
+	InvalidRPC Code = "invalid-rpc"
+	// RemovedRPC is reported when an RPC is removed because the types of
+	// its parameters or results can not be resolved.
+	RemovedRPC Code = "removed-rpc"
+	// InvalidFieldNumber is reported when the number given to a field
+	// with a proto tag is out of range or taken by another field.
+	InvalidFieldNumber Code = "invalid-field-number"
+	// ImportCycle is reported when some packages of the schema import
+	// each other.
+	ImportCycle Code = "import-cycle"
+	// CommandError is reported when a command fails.
+	CommandError Code = "command-error"
+	// ScanError is reported when a package can not be scanned, so it is
+	// left out of the schema.
+	ScanError Code = "scan-error"
+	// NonIntegerEnum is reported when the constants of a type are not
+	// integers, so they do not make an enum and the type is represented
+	// as its underlying type.
+	NonIntegerEnum Code = "non-integer-enum"
+	// UnscannedPlatform is reported when a package can not be scanned for
+	// one of the platforms, but it can for the rest.
+	UnscannedPlatform Code = "unscanned-platform"
+)
+
+var descriptions = map[Code]string{
+	UnsupportedType:    "A type can not be represented in the schema.",
+	DuplicateField:     "A struct has two fields with the same name.",
+	InvalidEmbedded:    "An embedded field is not a struct.",
+	UnscannedPackage:   "A followed package can not be scanned.",
+	RemovedField:       "A field was removed from the schema.",
+	RemovedStruct:      "A struct was removed from the schema.",
+	MapAsList:          "A map is represented as a list of entries.",
+	RemovalSummary:     "Summary of the fields and structs removed from the schema.",
+	UnusedSuppression:  "An ignore directive does not suppress any diagnostic.",
+	InvalidRPC:         "A function can not be exposed as an RPC.",
+	RemovedRPC:         "An RPC was removed from the schema.",
+	InvalidFieldNumber: "A field has an invalid number.",
+	ImportCycle:        "Some packages of the schema import each other.",
+	CommandError:       "A command failed.",
+	ScanError:          "A package can not be scanned.",
+	NonIntegerEnum:     "The constants of a type are not integers, so they are not an enum.",
+	UnscannedPlatform:  "A package can not be scanned for one of the platforms.",
+}
+
+// Description returns a short description of the kind of diagnostics
+// identified by the code.
+func (c Code) Description() string {
+	return descriptions[c]
+}
+
+// Diagnostic is a message about something found while scanning or
+// resolving packages.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	// Pos is the position in the source code the diagnostic refers to,
+	// if any.
+	Pos token.Position
+	// Type is the qualified name of the type the diagnostic refers to,
+	// such as `github.com/foo/bar.Baz`, if any.
+	Type string
+}
+
+func (d *Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+	}
+	return d.Message
+}
+
+// Reporter receives the diagnostics. Implementations must be safe for
+// concurrent use, as packages are scanned concurrently.
+type Reporter interface {
+	Report(*Diagnostic)
+}
+
+// Console is a reporter writing the diagnostics in a human readable way,
+// with colors if the output is a terminal.
+type Console struct {
+	mut sync.Mutex
+	w   io.Writer
+}
+
+// NewConsole returns a new console reporter writing to the given writer.
+func NewConsole(w io.Writer) *Console {
+	return &Console{w: w}
+}
+
 type Color func(string, ...interface{}) string
 
-func Warn(format string, args ...interface{}) {
-	report(color.YellowString, "WARN", format, args...)
+var levels = map[Severity]struct {
+	color Color
+	label string
+}{
+	Info:    {color.GreenString, "INFO"},
+	Warning: {color.YellowString, "WARN"},
+	Error:   {color.RedString, "ERROR"},
+}
+
+// Report implements the Reporter interface.
+func (c *Console) Report(d *Diagnostic) {
+	lvl := levels[d.Severity]
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if d.Code != "" {
+		fmt.Fprintf(c.w, "%s: %s [%s]\n", lvl.color(lvl.label), d, d.Code)
+	} else {
+		fmt.Fprintf(c.w, "%s: %s\n", lvl.color(lvl.label), d)
+	}
 }
 
-func Error(format string, args ...interface{}) {
-	report(color.RedString, "ERROR", format, args...)
+// Collector is a reporter keeping all the diagnostics in memory.
+type Collector struct {
+	mut         sync.Mutex
+	diagnostics []*Diagnostic
 }
 
-func Info(format string, args ...interface{}) {
-	report(color.GreenString, "INFO", format, args...)
+// Report implements the Reporter interface.
+func (c *Collector) Report(d *Diagnostic) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.diagnostics = append(c.diagnostics, d)
 }
 
-func report(color Color, lvl string, format string, args ...interface{}) {
-	fmt.Printf("%s: %s\n", color(lvl), fmt.Sprintf(format, args...))
+// Diagnostics returns all the collected diagnostics in the order in which
+// they were reported.
+func (c *Collector) Diagnostics() []*Diagnostic {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]*Diagnostic(nil), c.diagnostics...)
 }
+
+// Count returns the number of collected diagnostics with the given
+// severity.
+func (c *Collector) Count(s Severity) int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	var n int
+	for _, d := range c.diagnostics {
+		if d.Severity == s {
+			n++
+		}
+	}
+	return n
+}
+
+// Default is the reporter used when none is given, which writes the
+// diagnostics to the standard output.
+var Default Reporter = NewConsole(os.Stdout)
+
+// Discard is a reporter ignoring all the diagnostics.
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Report(*Diagnostic) {}
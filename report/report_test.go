@@ -0,0 +1,110 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/token"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsole(t *testing.T) {
+	color.NoColor = true
+
+	var buf bytes.Buffer
+	c := NewConsole(&buf)
+	c.Report(&Diagnostic{
+		Severity: Warning,
+		Code:     UnsupportedType,
+		Message:  "ignoring type chan int",
+		Pos:      token.Position{Filename: "foo.go", Line: 3, Column: 2},
+	})
+	c.Report(&Diagnostic{Severity: Info, Message: "done"})
+
+	require.Equal(t, "WARN: foo.go:3:2: ignoring type chan int [unsupported-type]\nINFO: done\n", buf.String())
+}
+
+func TestCollector(t *testing.T) {
+	var c Collector
+	c.Report(&Diagnostic{Severity: Warning, Code: RemovedField})
+	c.Report(&Diagnostic{Severity: Error})
+	c.Report(&Diagnostic{Severity: Warning, Code: RemovedStruct})
+
+	require.Equal(t, 3, len(c.Diagnostics()))
+	require.Equal(t, RemovedStruct, c.Diagnostics()[2].Code)
+	require.Equal(t, 2, c.Count(Warning))
+	require.Equal(t, 1, c.Count(Error))
+	require.Equal(t, 0, c.Count(Info))
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	j := NewJSON(&buf)
+	j.Report(&Diagnostic{
+		Severity: Warning,
+		Code:     RemovedField,
+		Message:  "field removed",
+		Pos:      token.Position{Filename: "foo.go", Line: 3, Column: 2},
+		Type:     "foo.Foo",
+	})
+	j.Report(&Diagnostic{Severity: Error, Message: "failed"})
+	require.Nil(t, j.Err())
+
+	expected := `{"severity":"warning","code":"removed-field","message":"field removed","file":"foo.go","line":3,"column":2,"type":"foo.Foo"}
+{"severity":"error","message":"failed"}
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSARIF(&buf, "/src/project")
+	s.Report(&Diagnostic{
+		Severity: Warning,
+		Code:     RemovedField,
+		Message:  "field removed",
+		Pos:      token.Position{Filename: "/src/project/foo/foo.go", Line: 3, Column: 2},
+		Type:     "foo.Foo",
+	})
+	s.Report(&Diagnostic{
+		Severity: Info,
+		Code:     RemovalSummary,
+		Message:  "1 fields removed",
+		Pos:      token.Position{Filename: "/other/bar.go", Line: 1},
+	})
+	s.Report(&Diagnostic{Severity: Error, Message: "failed"})
+	require.Nil(t, s.Close())
+
+	var log sarifLog
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+	require.Equal(t, "2.1.0", log.Version)
+	require.Equal(t, 1, len(log.Runs))
+
+	run := log.Runs[0]
+	require.Equal(t, "proteus", run.Tool.Driver.Name)
+	require.Equal(t, []sarifRule{
+		{ID: "removal-summary", ShortDescription: sarifMessage{RemovalSummary.Description()}},
+		{ID: "removed-field", ShortDescription: sarifMessage{RemovedField.Description()}},
+	}, run.Tool.Driver.Rules)
+
+	require.Equal(t, 3, len(run.Results))
+	require.Equal(t, sarifResult{
+		RuleID:  "removed-field",
+		Level:   "warning",
+		Message: sarifMessage{"field removed"},
+		Locations: []sarifLocation{{sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: "foo/foo.go", URIBaseID: "SRCROOT"},
+			Region:           &sarifRegion{StartLine: 3, StartColumn: 2},
+		}}},
+		Properties: map[string]string{"type": "foo.Foo"},
+	}, run.Results[0])
+
+	require.Equal(t, "note", run.Results[1].Level)
+	require.Equal(t, sarifArtifactLocation{URI: "/other/bar.go"}, run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation)
+
+	require.Equal(t, "error", run.Results[2].Level)
+	require.Equal(t, "", run.Results[2].RuleID)
+	require.Nil(t, run.Results[2].Locations)
+}
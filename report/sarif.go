@@ -0,0 +1,210 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	srcRoot      = "SRCROOT"
+)
+
+// SARIF is a reporter collecting the diagnostics to write them as a SARIF
+// log when it is closed, so they can be shown by code review tools.
+type SARIF struct {
+	mut         sync.Mutex
+	w           io.Writer
+	root        string
+	diagnostics []*Diagnostic
+}
+
+// NewSARIF returns a new SARIF reporter writing to the given writer. The
+// files of the diagnostics inside root are written relative to it, so
+// they match the paths of a repository checked out there. If root is
+// empty, file paths are written as they are.
+func NewSARIF(w io.Writer, root string) *SARIF {
+	return &SARIF{w: w, root: root}
+}
+
+// Report implements the Reporter interface.
+func (s *SARIF) Report(d *Diagnostic) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.diagnostics = append(s.diagnostics, d)
+}
+
+// Close writes the SARIF log with all the reported diagnostics.
+func (s *SARIF) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var (
+		results = make([]sarifResult, 0, len(s.diagnostics))
+		rules   = make(map[Code]struct{})
+	)
+	for _, d := range s.diagnostics {
+		if d.Code != "" {
+			rules[d.Code] = struct{}{}
+		}
+		results = append(results, s.result(d))
+	}
+
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "proteus",
+				InformationURI: "https://github.com/src-d/proteus",
+				Rules:          sarifRules(rules),
+			}},
+			Results: results,
+		}},
+	})
+}
+
+func (s *SARIF) result(d *Diagnostic) sarifResult {
+	r := sarifResult{
+		RuleID:  string(d.Code),
+		Level:   sarifLevel(d.Severity),
+		Message: sarifMessage{Text: d.Message},
+	}
+
+	if d.Pos.Filename != "" {
+		loc := sarifArtifactLocation{URI: filepath.ToSlash(d.Pos.Filename)}
+		if s.root != "" {
+			if rel, err := relPath(s.root, d.Pos.Filename); err == nil && !isParent(rel) {
+				loc = sarifArtifactLocation{URI: filepath.ToSlash(rel), URIBaseID: srcRoot}
+			}
+		}
+
+		var region *sarifRegion
+		if d.Pos.Line > 0 {
+			region = &sarifRegion{StartLine: d.Pos.Line, StartColumn: d.Pos.Column}
+		}
+
+		r.Locations = []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: loc,
+				Region:           region,
+			},
+		}}
+	}
+
+	if d.Type != "" {
+		r.Properties = map[string]string{"type": d.Type}
+	}
+
+	return r
+}
+
+func relPath(root, path string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(root, path)
+}
+
+// isParent reports whether the relative path rel is outside of the
+// directory it is relative to.
+func isParent(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func sarifLevel(s Severity) string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func sarifRules(codes map[Code]struct{}) []sarifRule {
+	var rules = make([]sarifRule, 0, len(codes))
+	for c := range codes {
+		rules = append(rules, sarifRule{
+			ID:               string(c),
+			ShortDescription: sarifMessage{Text: c.Description()},
+		})
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId,omitempty"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
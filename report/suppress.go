@@ -0,0 +1,166 @@
+package report
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"sync"
+)
+
+// IgnoreDirective is the comment directive suppressing the diagnostics of
+// the given codes on the field or type it documents, e.g.
+// `//proteus:ignore unsupported-type removed-field`.
+const IgnoreDirective = "//proteus:ignore"
+
+// Suppression is an ignore directive suppressing the diagnostics of some
+// codes in a range of lines of a source file.
+type Suppression struct {
+	// Pos is the position of the directive.
+	Pos token.Position
+	// Start and End are the positions of the start and end of the
+	// declaration the directive applies to.
+	Start, End token.Position
+	// Codes are the codes of the suppressed diagnostics.
+	Codes []Code
+}
+
+// ParseIgnoreDirective returns the codes listed in the given comment, which
+// can be separated by spaces or commas, if it is an ignore directive.
+func ParseIgnoreDirective(comment string) ([]Code, bool) {
+	if !strings.HasPrefix(comment, IgnoreDirective) {
+		return nil, false
+	}
+
+	rest := strings.TrimPrefix(comment, IgnoreDirective)
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return nil, false
+	}
+
+	var codes []Code
+	for _, c := range strings.FieldsFunc(rest, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	}) {
+		codes = append(codes, Code(c))
+	}
+	return codes, true
+}
+
+func (s *Suppression) contains(pos token.Position) bool {
+	return pos.Filename == s.Start.Filename &&
+		pos.Line >= s.Start.Line &&
+		pos.Line <= s.End.Line
+}
+
+// Suppressor is implemented by the reporters that can suppress diagnostics.
+// The scanner registers in them the suppressions found in the scanned
+// packages.
+type Suppressor interface {
+	Reporter
+	Suppress(*Suppression)
+}
+
+// SuppressionFilter is a reporter dropping the suppressed diagnostics and
+// passing the rest to another reporter.
+type SuppressionFilter struct {
+	reporter Reporter
+
+	mut          sync.Mutex
+	suppressions map[string]*suppression
+	order        []string
+}
+
+type suppression struct {
+	*Suppression
+	used map[Code]bool
+}
+
+// NewSuppressionFilter returns a new suppression filter passing the
+// diagnostics that are not suppressed to the given reporter.
+func NewSuppressionFilter(r Reporter) *SuppressionFilter {
+	return &SuppressionFilter{
+		reporter:     r,
+		suppressions: make(map[string]*suppression),
+	}
+}
+
+// Suppress implements the Suppressor interface. Adding the same directive
+// more than once, which happens when a package is scanned for several
+// platforms, has no effect.
+func (f *SuppressionFilter) Suppress(s *Suppression) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	key := s.Pos.String()
+	if _, ok := f.suppressions[key]; ok {
+		return
+	}
+
+	f.suppressions[key] = &suppression{s, make(map[Code]bool)}
+	f.order = append(f.order, key)
+}
+
+// Report implements the Reporter interface.
+func (f *SuppressionFilter) Report(d *Diagnostic) {
+	if f.suppressed(d) {
+		return
+	}
+	f.reporter.Report(d)
+}
+
+func (f *SuppressionFilter) suppressed(d *Diagnostic) bool {
+	if d.Code == "" || !d.Pos.IsValid() {
+		return false
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	var suppressed bool
+	for _, key := range f.order {
+		s := f.suppressions[key]
+		if !s.contains(d.Pos) {
+			continue
+		}
+
+		for _, c := range s.Codes {
+			if c == d.Code {
+				s.used[c] = true
+				suppressed = true
+			}
+		}
+	}
+	return suppressed
+}
+
+// ReportUnused reports a warning for every code of the suppressions that
+// did not suppress any diagnostic, so they can be removed. It must be
+// called once all the diagnostics have been reported.
+func (f *SuppressionFilter) ReportUnused() {
+	f.mut.Lock()
+	var unused []*Diagnostic
+	for _, key := range f.order {
+		s := f.suppressions[key]
+		for _, c := range s.Codes {
+			if s.used[c] {
+				continue
+			}
+
+			msg := fmt.Sprintf("suppression of %q is not used", c)
+			if _, ok := descriptions[c]; !ok {
+				msg = fmt.Sprintf("suppression of unknown diagnostic code %q is not used", c)
+			}
+
+			unused = append(unused, &Diagnostic{
+				Severity: Warning,
+				Code:     UnusedSuppression,
+				Message:  msg,
+				Pos:      s.Pos,
+			})
+		}
+	}
+	f.mut.Unlock()
+
+	for _, d := range unused {
+		f.reporter.Report(d)
+	}
+}
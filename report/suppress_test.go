@@ -0,0 +1,60 @@
+package report
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreDirective(t *testing.T) {
+	cases := []struct {
+		comment string
+		codes   []Code
+		ok      bool
+	}{
+		{"//proteus:ignore removed-field", []Code{RemovedField}, true},
+		{"//proteus:ignore removed-field, map-as-list  unsupported-type", []Code{RemovedField, MapAsList, UnsupportedType}, true},
+		{"//proteus:ignore", nil, true},
+		{"//proteus:ignored removed-field", nil, false},
+		{"// proteus:ignore removed-field", nil, false},
+		{"// some comment", nil, false},
+	}
+
+	for _, c := range cases {
+		codes, ok := ParseIgnoreDirective(c.comment)
+		require.Equal(t, c.ok, ok, c.comment)
+		require.Equal(t, c.codes, codes, c.comment)
+	}
+}
+
+func TestSuppressionFilter(t *testing.T) {
+	var c Collector
+	f := NewSuppressionFilter(&c)
+
+	pos := func(line int) token.Position {
+		return token.Position{Filename: "foo.go", Line: line, Column: 1}
+	}
+
+	s := &Suppression{
+		Pos:   pos(2),
+		Start: pos(3),
+		End:   pos(6),
+		Codes: []Code{RemovedField, MapAsList},
+	}
+	f.Suppress(s)
+	f.Suppress(s)
+
+	f.Report(&Diagnostic{Severity: Warning, Code: RemovedField, Pos: pos(4)})
+	f.Report(&Diagnostic{Severity: Warning, Code: RemovedField, Pos: pos(7)})
+	f.Report(&Diagnostic{Severity: Warning, Code: UnsupportedType, Pos: pos(5)})
+	f.Report(&Diagnostic{Severity: Warning, Code: RemovedField, Pos: token.Position{Filename: "bar.go", Line: 4}})
+	require.Equal(t, 3, len(c.Diagnostics()))
+
+	f.ReportUnused()
+	diagnostics := c.Diagnostics()
+	require.Equal(t, 4, len(diagnostics))
+	require.Equal(t, UnusedSuppression, diagnostics[3].Code)
+	require.Equal(t, pos(2), diagnostics[3].Pos)
+	require.Contains(t, diagnostics[3].Message, string(MapAsList))
+}
@@ -0,0 +1,404 @@
+package resolver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/src-d/proteus/scanner"
+)
+
+// NodeKind is the kind of type represented by a node of the graph.
+type NodeKind int
+
+const (
+	// MessageNode is a node representing a struct.
+	MessageNode NodeKind = iota
+	// EnumNode is a node representing an enum.
+	EnumNode
+	// ServiceNode is a node representing the service made up by the
+	// functions of a package or the methods of a type.
+	ServiceNode
+)
+
+// Node is a struct, enum or service of the dependency graph.
+type Node struct {
+	Package string
+	Name    string
+	Kind    NodeKind
+	// Dependencies are the nodes referenced by this node.
+	Dependencies []*Node
+	// Dependents are the nodes referencing this node.
+	Dependents []*Node
+}
+
+func (n *Node) String() string {
+	return fmt.Sprintf("%s.%s", n.Package, n.Name)
+}
+
+// Graph is the graph of dependencies between the structs, enums and
+// services of a collection of packages, where there is an edge from a
+// struct to every struct or enum referenced by its fields, and from a
+// service to every struct or enum referenced by the parameters and results
+// of its functions. Types of packages that are not in the collection are
+// not part of the graph.
+type Graph struct {
+	nodes map[string]*Node
+}
+
+// Graph returns the dependency graph of the packages, which should be
+// already resolved.
+func (pkgs Packages) Graph() *Graph {
+	g := &Graph{nodes: make(map[string]*Node)}
+
+	for _, p := range pkgs {
+		for _, e := range p.Enums {
+			g.add(&Node{Package: p.Path, Name: e.Name, Kind: EnumNode})
+		}
+	}
+
+	forEachStruct(pkgs, func(p *scanner.Package, s *scanner.Struct) {
+		g.add(&Node{Package: p.Path, Name: s.Name, Kind: MessageNode})
+	})
+
+	forEachStruct(pkgs, func(p *scanner.Package, s *scanner.Struct) {
+		from := g.nodes[fmt.Sprintf("%s.%s", p.Path, s.Name)]
+		for _, f := range s.Fields {
+			for _, name := range referencedTypes(f.Type) {
+				if to, ok := g.nodes[name]; ok {
+					g.link(from, to)
+				}
+			}
+		}
+	})
+
+	for _, p := range pkgs {
+		for _, f := range p.Funcs {
+			// A service whose name is taken by a type is not generated.
+			name := serviceName(p, f)
+			from := g.nodes[fmt.Sprintf("%s.%s", p.Path, name)]
+			switch {
+			case from == nil:
+				from = &Node{Package: p.Path, Name: name, Kind: ServiceNode}
+				g.add(from)
+			case from.Kind != ServiceNode:
+				continue
+			}
+
+			for _, field := range f.Fields() {
+				for _, name := range referencedTypes(field.Type) {
+					if to, ok := g.nodes[name]; ok && to.Kind != ServiceNode {
+						g.link(from, to)
+					}
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+// serviceName returns the name of the service the given function belongs
+// to, which is named after its receiver or, if it has none, its package.
+func serviceName(p *scanner.Package, f *scanner.Func) string {
+	if f.Receiver != nil {
+		return f.Receiver.Name + "Service"
+	}
+
+	name := p.Name
+	if name != "" {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	return name + "Service"
+}
+
+func (g *Graph) add(n *Node) {
+	g.nodes[n.String()] = n
+}
+
+func (g *Graph) link(from, to *Node) {
+	for _, n := range from.Dependencies {
+		if n == to {
+			return
+		}
+	}
+
+	from.Dependencies = append(from.Dependencies, to)
+	to.Dependents = append(to.Dependents, from)
+}
+
+// Node returns the node with the given qualified name, such as
+// `github.com/foo/bar.Baz`, or nil if there is none.
+func (g *Graph) Node(name string) *Node {
+	return g.nodes[name]
+}
+
+// Nodes returns all the nodes of the graph sorted by qualified name.
+func (g *Graph) Nodes() []*Node {
+	var nodes = make([]*Node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sortNodes(nodes)
+	return nodes
+}
+
+// DependentsOf returns all the nodes that directly or indirectly depend on
+// the node with the given qualified name, that is, the nodes that pull
+// that type into the schema, sorted by qualified name.
+func (g *Graph) DependentsOf(name string) []*Node {
+	n, ok := g.nodes[name]
+	if !ok {
+		return nil
+	}
+
+	var (
+		result []*Node
+		seen   = map[*Node]struct{}{n: struct{}{}}
+		visit  func(*Node)
+	)
+	visit = func(n *Node) {
+		for _, d := range n.Dependents {
+			if _, ok := seen[d]; !ok {
+				seen[d] = struct{}{}
+				result = append(result, d)
+				visit(d)
+			}
+		}
+	}
+	visit(n)
+
+	sortNodes(result)
+	return result
+}
+
+// Subgraph returns a graph with only the given nodes and the edges
+// between them.
+func (g *Graph) Subgraph(nodes []*Node) *Graph {
+	sub := &Graph{nodes: make(map[string]*Node)}
+	for _, n := range nodes {
+		sub.add(&Node{Package: n.Package, Name: n.Name, Kind: n.Kind})
+	}
+
+	for _, n := range nodes {
+		for _, d := range n.Dependencies {
+			if to, ok := sub.nodes[d.String()]; ok {
+				sub.link(sub.nodes[n.String()], to)
+			}
+		}
+	}
+
+	return sub
+}
+
+// PackageCycles returns the cycles between packages caused by their types
+// referencing each other. Each cycle is the sorted list of the paths of
+// the packages involved in it. Such cycles will become import cycles
+// between the generated proto files, which are not allowed.
+func (g *Graph) PackageCycles() [][]string {
+	deps := make(map[string]map[string]struct{})
+	for _, n := range g.nodes {
+		if _, ok := deps[n.Package]; !ok {
+			deps[n.Package] = make(map[string]struct{})
+		}
+
+		for _, d := range n.Dependencies {
+			if d.Package != n.Package {
+				deps[n.Package][d.Package] = struct{}{}
+			}
+		}
+	}
+
+	var cycles [][]string
+	for _, c := range stronglyConnected(deps) {
+		if len(c) > 1 {
+			sort.Strings(c)
+			cycles = append(cycles, c)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+// stronglyConnected returns the strongly connected components of the given
+// graph using Tarjan's algorithm.
+func stronglyConnected(graph map[string]map[string]struct{}) [][]string {
+	var (
+		index   = make(map[string]int)
+		lowlink = make(map[string]int)
+		onStack = make(map[string]bool)
+		stack   []string
+		result  [][]string
+		visit   func(string)
+	)
+
+	visit = func(v string) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range sortedSet(graph[v]) {
+			if _, ok := index[w]; !ok {
+				visit(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], index[w])
+			}
+		}
+
+		if lowlink[v] == index[v] {
+			var component []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			result = append(result, component)
+		}
+	}
+
+	var vertices = make(map[string]struct{}, len(graph))
+	for v := range graph {
+		vertices[v] = struct{}{}
+	}
+
+	for _, v := range sortedSet(vertices) {
+		if _, ok := index[v]; !ok {
+			visit(v)
+		}
+	}
+
+	return result
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format, with the nodes
+// grouped by package.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph proteus {\n")
+	b.WriteString("\trankdir=LR;\n")
+
+	for i, pkg := range g.packages() {
+		fmt.Fprintf(&b, "\tsubgraph \"cluster_%d\" {\n", i)
+		fmt.Fprintf(&b, "\t\tlabel=%q;\n", pkg)
+		for _, n := range g.Nodes() {
+			if n.Package != pkg {
+				continue
+			}
+
+			shape := "box"
+			switch n.Kind {
+			case EnumNode:
+				shape = "ellipse"
+			case ServiceNode:
+				shape = "hexagon"
+			}
+			fmt.Fprintf(&b, "\t\t%q [label=%q, shape=%s];\n", n.String(), n.Name, shape)
+		}
+		b.WriteString("\t}\n")
+	}
+
+	for _, n := range g.Nodes() {
+		for _, d := range sortedNodes(n.Dependencies) {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", n.String(), d.String())
+		}
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart, with the nodes
+// grouped by package.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	var (
+		b     strings.Builder
+		nodes = g.Nodes()
+		ids   = make(map[*Node]string, len(nodes))
+	)
+	for i, n := range nodes {
+		ids[n] = fmt.Sprintf("n%d", i)
+	}
+
+	b.WriteString("graph LR\n")
+	for i, pkg := range g.packages() {
+		fmt.Fprintf(&b, "\tsubgraph p%d [\"%s\"]\n", i, pkg)
+		for _, n := range nodes {
+			if n.Package != pkg {
+				continue
+			}
+
+			switch n.Kind {
+			case EnumNode:
+				fmt.Fprintf(&b, "\t\t%s([\"%s\"])\n", ids[n], n.Name)
+			case ServiceNode:
+				fmt.Fprintf(&b, "\t\t%s{{\"%s\"}}\n", ids[n], n.Name)
+			default:
+				fmt.Fprintf(&b, "\t\t%s[\"%s\"]\n", ids[n], n.Name)
+			}
+		}
+		b.WriteString("\tend\n")
+	}
+
+	for _, n := range nodes {
+		for _, d := range sortedNodes(n.Dependencies) {
+			fmt.Fprintf(&b, "\t%s --> %s\n", ids[n], ids[d])
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// packages returns the sorted paths of the packages with nodes.
+func (g *Graph) packages() []string {
+	var pkgs = make(map[string]struct{})
+	for _, n := range g.nodes {
+		pkgs[n.Package] = struct{}{}
+	}
+	return sortedSet(pkgs)
+}
+
+// referencedTypes returns the qualified names of all the named types
+// referenced by the given type.
+func referencedTypes(typ scanner.Type) []string {
+	switch t := typ.(type) {
+	case *scanner.Named:
+		return []string{t.String()}
+	case *scanner.Map:
+		return append(referencedTypes(t.Key), referencedTypes(t.Value)...)
+	}
+	return nil
+}
+
+func sortNodes(nodes []*Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].String() < nodes[j].String()
+	})
+}
+
+func sortedNodes(nodes []*Node) []*Node {
+	var result = make([]*Node, len(nodes))
+	copy(result, nodes)
+	sortNodes(result)
+	return result
+}
+
+func sortedSet(set map[string]struct{}) []string {
+	var result = make([]string, 0, len(set))
+	for s := range set {
+		result = append(result, s)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,178 @@
+package resolver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/src-d/proteus/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func graphPackages() Packages {
+	return Packages{
+		&scanner.Package{
+			Path: "foo",
+			Structs: []*scanner.Struct{
+				{
+					Name: "Foo",
+					Fields: []*scanner.Field{
+						{Name: "Bar", Type: scanner.NewNamed("bar", "Bar")},
+						{Name: "Kind", Type: scanner.NewNamed("foo", "Kind")},
+						{Name: "Time", Type: scanner.NewNamed("time", "Time")},
+					},
+				},
+				{
+					Name: "Qux",
+					Fields: []*scanner.Field{
+						{Name: "Foos", Type: repeated(scanner.NewNamed("foo", "Foo"))},
+					},
+				},
+			},
+			Enums: []*scanner.Enum{enum("Kind", "A", "B")},
+		},
+		&scanner.Package{
+			Path: "bar",
+			Structs: []*scanner.Struct{
+				{
+					Name: "Bar",
+					Fields: []*scanner.Field{
+						{Name: "ID", Type: scanner.NewBasic("int")},
+						{Name: "Kinds", Type: scanner.NewMap(
+							scanner.NewBasic("string"),
+							scanner.NewNamed("bar", "Status"),
+						)},
+					},
+				},
+			},
+			Enums: []*scanner.Enum{enum("Status", "On", "Off")},
+		},
+	}
+}
+
+func nodeNames(nodes []*Node) []string {
+	var names []string
+	for _, n := range nodes {
+		names = append(names, n.String())
+	}
+	return names
+}
+
+func TestGraph(t *testing.T) {
+	g := graphPackages().Graph()
+
+	require.Equal(t, []string{"bar.Bar", "bar.Status", "foo.Foo", "foo.Kind", "foo.Qux"}, nodeNames(g.Nodes()))
+	require.Nil(t, g.Node("time.Time"))
+
+	foo := g.Node("foo.Foo")
+	require.Equal(t, MessageNode, foo.Kind)
+	require.Equal(t, []string{"bar.Bar", "foo.Kind"}, nodeNames(foo.Dependencies))
+	require.Equal(t, []string{"foo.Qux"}, nodeNames(foo.Dependents))
+
+	kind := g.Node("foo.Kind")
+	require.Equal(t, EnumNode, kind.Kind)
+	require.Equal(t, []string{"foo.Foo"}, nodeNames(kind.Dependents))
+
+	require.Equal(t, []string{"bar.Status"}, nodeNames(g.Node("bar.Bar").Dependencies))
+	require.Equal(t, []string{"bar.Bar", "foo.Foo", "foo.Qux"}, nodeNames(g.DependentsOf("bar.Status")))
+	require.Nil(t, g.DependentsOf("foo.Qux"))
+	require.Nil(t, g.DependentsOf("foo.Unknown"))
+}
+
+func TestGraphSubgraph(t *testing.T) {
+	g := graphPackages().Graph()
+	sub := g.Subgraph([]*Node{g.Node("foo.Foo"), g.Node("foo.Qux")})
+
+	require.Equal(t, []string{"foo.Foo", "foo.Qux"}, nodeNames(sub.Nodes()))
+	require.Nil(t, sub.Node("foo.Foo").Dependencies)
+	require.Equal(t, []string{"foo.Foo"}, nodeNames(sub.Node("foo.Qux").Dependencies))
+}
+
+func TestGraphPackageCycles(t *testing.T) {
+	pkgs := graphPackages()
+	require.Nil(t, pkgs.Graph().PackageCycles())
+
+	pkgs[1].Structs[0].Fields = append(
+		pkgs[1].Structs[0].Fields,
+		&scanner.Field{Name: "Qux", Type: scanner.NewNamed("foo", "Qux")},
+	)
+	require.Equal(t, [][]string{{"bar", "foo"}}, pkgs.Graph().PackageCycles())
+}
+
+func TestGraphServices(t *testing.T) {
+	pkgs := graphPackages()
+	pkgs[1].Name = "bar"
+	pkgs[1].Funcs = []*scanner.Func{
+		{
+			Name:    "Find",
+			Params:  []*scanner.Field{{Name: "id", Type: scanner.NewBasic("int")}},
+			Results: []*scanner.Field{{Type: scanner.NewNamed("foo", "Qux")}},
+		},
+		{
+			Name:         "Watch",
+			ServerStream: &scanner.Stream{Field: &scanner.Field{Type: scanner.NewNamed("bar", "Status")}},
+		},
+		{
+			Name:     "Get",
+			Receiver: &scanner.Receiver{Name: "Store"},
+			Results:  []*scanner.Field{{Type: scanner.NewNamed("bar", "Bar")}},
+		},
+	}
+
+	g := pkgs.Graph()
+	svc := g.Node("bar.BarService")
+	require.NotNil(t, svc)
+	require.Equal(t, ServiceNode, svc.Kind)
+	require.Equal(t, []string{"bar.Status", "foo.Qux"}, nodeNames(sortedNodes(svc.Dependencies)))
+	require.Equal(t, []string{"bar.Bar"}, nodeNames(g.Node("bar.StoreService").Dependencies))
+	require.Equal(t, []string{"bar.BarService", "bar.StoreService", "foo.Foo", "foo.Qux"}, nodeNames(g.DependentsOf("bar.Bar")))
+
+	require.Equal(t, [][]string{{"bar", "foo"}}, g.PackageCycles(), "services introduce cycles")
+}
+
+func TestGraphWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, graphPackages().Graph().WriteDOT(&buf))
+
+	expected := `digraph proteus {
+	rankdir=LR;
+	subgraph "cluster_0" {
+		label="bar";
+		"bar.Bar" [label="Bar", shape=box];
+		"bar.Status" [label="Status", shape=ellipse];
+	}
+	subgraph "cluster_1" {
+		label="foo";
+		"foo.Foo" [label="Foo", shape=box];
+		"foo.Kind" [label="Kind", shape=ellipse];
+		"foo.Qux" [label="Qux", shape=box];
+	}
+	"bar.Bar" -> "bar.Status";
+	"foo.Foo" -> "bar.Bar";
+	"foo.Foo" -> "foo.Kind";
+	"foo.Qux" -> "foo.Foo";
+}
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestGraphWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, graphPackages().Graph().WriteMermaid(&buf))
+
+	expected := `graph LR
+	subgraph p0 ["bar"]
+		n0["Bar"]
+		n1(["Status"])
+	end
+	subgraph p1 ["foo"]
+		n2["Foo"]
+		n3(["Kind"])
+		n4["Qux"]
+	end
+	n0 --> n1
+	n2 --> n0
+	n2 --> n3
+	n4 --> n2
+`
+	require.Equal(t, expected, buf.String())
+}
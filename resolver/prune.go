@@ -0,0 +1,229 @@
+package resolver
+
+import (
+	"fmt"
+	"go/token"
+
+	"github.com/src-d/proteus/report"
+	"github.com/src-d/proteus/scanner"
+)
+
+// Removal is a field or a struct removed during the resolution.
+type Removal struct {
+	// Package is the path of the package of the struct.
+	Package string
+	// Struct is the name of the struct removed or containing the removed
+	// field.
+	Struct string
+	// Field is the name of the removed field or empty if the whole struct
+	// was removed.
+	Field string
+	// Reason explains why it was removed.
+	Reason string
+	// Silent is true when the removal was intentional and it should not
+	// be reported as a warning.
+	Silent bool
+	// Pos is the position of the declaration of the removed field or
+	// struct.
+	Pos token.Position
+}
+
+func (r *Removal) String() string {
+	if r.Field == "" {
+		return fmt.Sprintf("struct %q of package %s was removed because %s", r.Struct, r.Package, r.Reason)
+	}
+	return fmt.Sprintf("field %q of struct %q of package %s was removed because %s", r.Field, r.Struct, r.Package, r.Reason)
+}
+
+// nonEmptyStructs returns the set of all structs with at least a field.
+func nonEmptyStructs(pkgs Packages) map[*scanner.Struct]struct{} {
+	result := make(map[*scanner.Struct]struct{})
+	forEachStruct(pkgs, func(_ *scanner.Package, s *scanner.Struct) {
+		if len(s.Fields) > 0 {
+			result[s] = struct{}{}
+		}
+	})
+	return result
+}
+
+// prune removes the structs that had fields before being resolved but
+// have none left and the fields referencing types that do not exist in
+// the scanned packages, either because they were removed or because they
+// were never there, such as excluded types. As removing a field can leave
+// another struct empty, it is repeated until there is nothing to remove.
+func prune(pkgs Packages, nonEmpty map[*scanner.Struct]struct{}) []*Removal {
+	var removals []*Removal
+	for {
+		var (
+			known   = knownTypes(pkgs)
+			removed []*Removal
+		)
+
+		for _, p := range pkgs {
+			var rs []*Removal
+			p.Structs, rs = pruneStructs(p, p.Structs, known, nonEmpty)
+			removed = append(removed, rs...)
+		}
+
+		if len(removed) == 0 {
+			return removals
+		}
+		removals = append(removals, removed...)
+	}
+}
+
+func pruneStructs(
+	p *scanner.Package,
+	structs []*scanner.Struct,
+	known map[string]struct{},
+	nonEmpty map[*scanner.Struct]struct{},
+) ([]*scanner.Struct, []*Removal) {
+	var (
+		result   = make([]*scanner.Struct, 0, len(structs))
+		removals []*Removal
+	)
+
+	for _, s := range structs {
+		var fields = make([]*scanner.Field, 0, len(s.Fields))
+		for _, f := range s.Fields {
+			if name := danglingType(f.Type, known); name != "" {
+				removals = append(removals, &Removal{
+					Package: p.Path,
+					Struct:  s.Name,
+					Field:   f.Name,
+					Reason:  fmt.Sprintf("type %s does not exist or was removed", name),
+					Pos:     f.Pos,
+				})
+			} else {
+				fields = append(fields, f)
+			}
+		}
+		s.Fields = fields
+
+		var rs []*Removal
+		s.Nested, rs = pruneStructs(p, s.Nested, known, nonEmpty)
+		removals = append(removals, rs...)
+
+		if _, ok := nonEmpty[s]; ok && len(s.Fields) == 0 {
+			removals = append(removals, &Removal{
+				Package: p.Path,
+				Struct:  s.Name,
+				Reason:  "it has no fields left",
+				Pos:     s.Pos,
+			})
+			continue
+		}
+
+		result = append(result, s)
+	}
+
+	return result, removals
+}
+
+// pruneFuncs removes the funcs with parameters or results referencing
+// types that do not exist in the scanned packages after pruning.
+func (r *Resolver) pruneFuncs(pkgs Packages) {
+	known := knownTypes(pkgs)
+	for _, p := range pkgs {
+		var funcs = make([]*scanner.Func, 0, len(p.Funcs))
+	outer:
+		for _, f := range p.Funcs {
+			for _, field := range f.Fields() {
+				if name := danglingType(field.Type, known); name != "" {
+					r.removeFunc(p, f, fmt.Sprintf("type %s does not exist or was removed", name))
+					continue outer
+				}
+			}
+			funcs = append(funcs, f)
+		}
+		p.Funcs = funcs
+	}
+}
+
+// danglingType returns the name of the type referenced by the given type
+// that belongs to one of the scanned packages but does not exist in it or
+// an empty string if there is none.
+func danglingType(typ scanner.Type, known map[string]struct{}) string {
+	switch t := typ.(type) {
+	case *scanner.Named:
+		if _, ok := known[t.Path]; !ok {
+			return ""
+		}
+
+		if _, ok := known[t.String()]; !ok {
+			return t.String()
+		}
+	case *scanner.Map:
+		if name := danglingType(t.Key, known); name != "" {
+			return name
+		}
+		return danglingType(t.Value, known)
+	}
+
+	return ""
+}
+
+// knownTypes returns a set with the paths of all the packages and the
+// qualified names of all the structs and enums in them.
+func knownTypes(pkgs Packages) map[string]struct{} {
+	result := make(map[string]struct{})
+	for _, p := range pkgs {
+		result[p.Path] = struct{}{}
+		for _, e := range p.Enums {
+			result[fmt.Sprintf("%s.%s", p.Path, e.Name)] = struct{}{}
+		}
+	}
+
+	forEachStruct(pkgs, func(p *scanner.Package, s *scanner.Struct) {
+		result[fmt.Sprintf("%s.%s", p.Path, s.Name)] = struct{}{}
+	})
+	return result
+}
+
+func forEachStruct(pkgs Packages, fn func(*scanner.Package, *scanner.Struct)) {
+	var walk func(*scanner.Package, []*scanner.Struct)
+	walk = func(p *scanner.Package, structs []*scanner.Struct) {
+		for _, s := range structs {
+			fn(p, s)
+			walk(p, s.Nested)
+		}
+	}
+
+	for _, p := range pkgs {
+		walk(p, p.Structs)
+	}
+}
+
+func (r *Resolver) reportRemovals(removals []*Removal) {
+	var (
+		fields, structs int
+		reporter        = r.reporter()
+	)
+	for _, rm := range removals {
+		code := report.RemovedField
+		if rm.Field == "" {
+			code = report.RemovedStruct
+			structs++
+		} else {
+			fields++
+		}
+
+		if !rm.Silent {
+			reporter.Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     code,
+				Message:  rm.String(),
+				Pos:      rm.Pos,
+				Type:     fmt.Sprintf("%s.%s", rm.Package, rm.Struct),
+			})
+		}
+	}
+
+	if len(removals) > 0 {
+		reporter.Report(&report.Diagnostic{
+			Severity: report.Info,
+			Code:     report.RemovalSummary,
+			Message:  fmt.Sprintf("%d fields and %d structs were removed during resolution", fields, structs),
+		})
+	}
+}
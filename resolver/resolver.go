@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/src-d/proteus/report"
 	"github.com/src-d/proteus/scanner"
@@ -15,81 +16,444 @@ import (
 // field would be changed from a named `IntList` type to a repeated basic
 // type `int`.
 type Resolver struct {
-	customTypes map[string]struct{}
+	// IgnoreMarshalers disables the automatic mapping of the named types
+	// of packages that are not scanned but implement the text or binary
+	// marshaling interfaces of the encoding package, which are mapped to
+	// strings and bytes respectively by default. When disabled, fields
+	// with those types are removed without any warning, as it is the
+	// expected outcome.
+	IgnoreMarshalers bool
+	// Reporter receives the diagnostics found while resolving. If it is
+	// nil, report.Default is used.
+	Reporter report.Reporter
+
+	customTypes map[string]*TypeMapping
+}
+
+// TypeMapping describes how a named type of a package that is not scanned
+// is represented in the schema, e.g. `github.com/google/uuid.UUID` as a
+// `string`.
+type TypeMapping struct {
+	// Type is the type used in the schema instead of the named type. If it
+	// is nil, the named type is kept as it is, which is the case of the
+	// types that are well known, such as `time.Time`.
+	Type scanner.Type
+	// Encode is the optional qualified name of the function converting a
+	// value of the named type into a value of Type, e.g.
+	// `github.com/foo/conv.UUIDToString`.
+	Encode string
+	// Decode is the optional qualified name of the function converting a
+	// value of Type back into a value of the named type.
+	Decode string
 }
 
 func New() *Resolver {
 	return &Resolver{
-		customTypes: map[string]struct{}{
-			"time.Time":     struct{}{},
-			"time.Duration": struct{}{},
+		customTypes: map[string]*TypeMapping{
+			"time.Time":     &TypeMapping{},
+			"time.Duration": &TypeMapping{},
 		},
 	}
 }
 
+// Register adds a mapping for the named type with the given qualified
+// name, e.g. `net/url.URL`. Fields of that type will not be removed
+// anymore, even if its package is not scanned, and will have the type
+// of the mapping instead. Registering a mapping for a type that already
+// has one replaces it.
+func (r *Resolver) Register(name string, m TypeMapping) {
+	r.customTypes[name] = &m
+}
+
+// Mapping returns the mapping of the named type with the given qualified
+// name or nil if there is none.
+func (r *Resolver) Mapping(name string) *TypeMapping {
+	return r.customTypes[name]
+}
+
+// Converters returns the qualified names of the functions encoding and
+// decoding the mapped types, sorted and without duplicates, which are
+// registered as converters by the generated Go code.
+func (r *Resolver) Converters() []string {
+	var (
+		names []string
+		seen  = make(map[string]bool)
+	)
+	for _, m := range r.customTypes {
+		for _, name := range []string{m.Encode, m.Decode} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Resolve checks the types of all the packages passed in a global manner.
 // Also, it sets to `true` the `Resolved` field of the package, meaning that
 // they can be safely used after it.
-func (r *Resolver) Resolve(pkgs Packages) {
+// Fields whose type can not be resolved are removed, as well as structs
+// left without fields and fields referencing them. All the removals are
+// returned and a summary of them is reported. Funcs with parameters or
+// results that can not be resolved are removed and reported too.
+func (r *Resolver) Resolve(pkgs Packages) []*Removal {
 	info := pkgs.Info()
+	nonEmpty := nonEmptyStructs(pkgs)
 
+	var removals []*Removal
 	for _, p := range pkgs {
-		r.resolvePackage(p, info)
+		removals = append(removals, r.resolvePackage(p, info)...)
 	}
+
+	removals = append(removals, prune(pkgs, nonEmpty)...)
+	r.pruneFuncs(pkgs)
+	r.reportRemovals(removals)
+	return removals
 }
 
-func (r *Resolver) isCustomType(n *scanner.Named) bool {
-	_, ok := r.customTypes[n.String()]
-	return ok
+func (r *Resolver) reporter() report.Reporter {
+	if r.Reporter == nil {
+		return report.Default
+	}
+	return r.Reporter
 }
 
-func (r *Resolver) resolvePackage(p *scanner.Package, info *PackagesInfo) {
+func (r *Resolver) resolvePackage(p *scanner.Package, info *PackagesInfo) []*Removal {
+	var removals []*Removal
 	for _, s := range p.Structs {
-		s.Fields = r.resolveStructFields(s.Fields, info)
+		removals = append(removals, r.resolveStruct(p, s, info)...)
 	}
+
+	var funcs = make([]*scanner.Func, 0, len(p.Funcs))
+	for _, f := range p.Funcs {
+		if err := r.resolveFunc(f, info); err != nil {
+			r.removeFunc(p, f, err.Error())
+		} else {
+			funcs = append(funcs, f)
+		}
+	}
+	p.Funcs = funcs
+
 	p.Resolved = true
+	return removals
 }
 
-func (r *Resolver) resolveStructFields(fields []*scanner.Field, info *PackagesInfo) []*scanner.Field {
-	var result = make([]*scanner.Field, 0, len(fields))
+// resolveFunc resolves the types of the parameters and results of the
+// given func, returning an error if any of them can not be resolved or
+// represented in a message.
+func (r *Resolver) resolveFunc(f *scanner.Func, info *PackagesInfo) error {
+	var streams []*scanner.Field
+	for _, s := range []*scanner.Stream{f.ClientStream, f.ServerStream} {
+		if s != nil {
+			streams = append(streams, s.Field)
+		}
+	}
+
+	for _, fields := range [][]*scanner.Field{f.Params, f.Results, streams} {
+		for i, field := range fields {
+			typ, err := r.resolveType(field.Type, info)
+			if typ == nil {
+				if err == nil {
+					err = fmt.Errorf("its type was intentionally ignored")
+				}
+				return fmt.Errorf("the type of %s can not be resolved: %s", paramName(field, i), err)
+			}
 
-	for _, f := range fields {
-		if typ := r.resolveType(f.Type, info); typ != nil {
+			if m, ok := typ.(*scanner.Map); ok {
+				if reason := invalidMapReason(m); reason != "" {
+					return fmt.Errorf("the map type of %s can not be represented because %s", paramName(field, i), reason)
+				}
+			}
+
+			field.Type = typ
+		}
+	}
+	return nil
+}
+
+func paramName(f *scanner.Field, i int) string {
+	if f.Name == "" {
+		return fmt.Sprintf("#%d", i+1)
+	}
+	return fmt.Sprintf("%q", f.Name)
+}
+
+func (r *Resolver) removeFunc(p *scanner.Package, f *scanner.Func, reason string) {
+	r.reporter().Report(&report.Diagnostic{
+		Severity: report.Warning,
+		Code:     report.RemovedRPC,
+		Message:  fmt.Sprintf("function %s of package %s will not be an RPC because %s", f.FullName(), p.Path, reason),
+		Pos:      f.Pos,
+		Type:     fmt.Sprintf("%s.%s", p.Path, f.FullName()),
+	})
+}
+
+func (r *Resolver) resolveStruct(p *scanner.Package, s *scanner.Struct, info *PackagesInfo) []*Removal {
+	var (
+		removals []*Removal
+		result   = make([]*scanner.Field, 0, len(s.Fields))
+	)
+
+	nested := s.Nested
+	for _, f := range s.Fields {
+		typ, err := r.resolveType(f.Type, info)
+		if m, ok := typ.(*scanner.Map); ok {
+			typ, err = r.resolveMap(p, s, f, m)
+		}
+
+		if typ != nil {
 			f.Type = typ
 			result = append(result, f)
+			continue
 		}
+
+		removal := &Removal{Package: p.Path, Struct: s.Name, Field: f.Name, Pos: f.Pos}
+		if err != nil {
+			removal.Reason = err.Error()
+		} else {
+			removal.Reason = "its type was intentionally ignored"
+			removal.Silent = true
+		}
+		removals = append(removals, removal)
 	}
+	s.Fields = result
 
-	return result
+	for _, n := range nested {
+		removals = append(removals, r.resolveStruct(p, n, info)...)
+	}
+	for _, e := range s.Nested[len(nested):] {
+		removals = append(removals, r.resolveEntry(p, e)...)
+	}
+	return removals
 }
 
-func (r *Resolver) resolveType(typ scanner.Type, info *PackagesInfo) (result scanner.Type) {
+// resolveEntry checks the fields of the given struct added by resolveMap
+// to represent the entries of a map. Their types are already resolved,
+// but their values may be maps that can not be represented either, which
+// become lists of entries too.
+func (r *Resolver) resolveEntry(p *scanner.Package, e *scanner.Struct) []*Removal {
+	var (
+		removals []*Removal
+		result   = make([]*scanner.Field, 0, len(e.Fields))
+	)
+	for _, f := range e.Fields {
+		m, ok := f.Type.(*scanner.Map)
+		if !ok {
+			result = append(result, f)
+			continue
+		}
+
+		typ, err := r.resolveMap(p, e, f, m)
+		if err != nil {
+			removals = append(removals, &Removal{
+				Package: p.Path,
+				Struct:  e.Name,
+				Field:   f.Name,
+				Pos:     f.Pos,
+				Reason:  err.Error(),
+			})
+			continue
+		}
+
+		f.Type = typ
+		result = append(result, f)
+	}
+	e.Fields = result
+
+	for _, n := range e.Nested {
+		removals = append(removals, r.resolveEntry(p, n)...)
+	}
+	return removals
+}
+
+// resolveType returns the resolved type of the given type or nil if it can
+// not be resolved, along with an error explaining why. A nil type with no
+// error means the type was intentionally ignored.
+func (r *Resolver) resolveType(typ scanner.Type, info *PackagesInfo) (scanner.Type, error) {
 	switch t := typ.(type) {
 	case *scanner.Named:
-		if r.isCustomType(t) {
-			return t
+		if m := r.Mapping(t.String()); m != nil {
+			if m.Type == nil {
+				return t, nil
+			}
+			return withFlags(m.Type.Clone(), t), nil
 		}
 
 		if _, ok := info.Packages[t.Path]; !ok {
-			report.Warn("type %q of package %s will be ignored because it was not present on the scan path", t.Name, t.Path)
-			return nil
+			if t.Marshaler != scanner.NoMarshaler {
+				return r.resolveMarshaler(t)
+			}
+
+			return nil, fmt.Errorf("type %q of package %s was not present on the scan path", t.Name, t.Path)
+		}
+
+		alias, err := info.AliasOf(t)
+		if err != nil {
+			return nil, err
 		}
 
-		alias := info.AliasOf(t)
 		if alias != nil {
-			return alias
+			return r.resolveType(alias, info)
+		}
+
+		return t, nil
+	case *scanner.Basic:
+		return t, nil
+	case *scanner.Map:
+		key, err := r.resolveType(t.Key, info)
+		if key == nil {
+			return nil, mapError("key", err)
+		}
+
+		val, err := r.resolveType(t.Value, info)
+		if val == nil {
+			return nil, mapError("value", err)
 		}
 
-		result = t
+		t.Key, t.Value = key, val
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("type is not supported")
+}
+
+// resolveMap checks that the given map type of the field f can be
+// represented as a protobuf map, whose keys can only be integral or
+// string types and whose values can not be repeated or maps. If it can
+// not, a nested struct with a key and a value fields is added to s to
+// represent the entries of the map and a repeated type of that struct
+// is returned instead.
+func (r *Resolver) resolveMap(p *scanner.Package, s *scanner.Struct, f *scanner.Field, m *scanner.Map) (scanner.Type, error) {
+	if m.IsRepeated() {
+		return nil, fmt.Errorf("repeated maps are not supported")
+	}
+
+	reason := invalidMapReason(m)
+	if reason == "" {
+		return m, nil
+	}
+
+	entry := &scanner.Struct{
+		Name: fmt.Sprintf("%s.%sEntry", s.Name, f.Name),
+		Pos:  f.Pos,
+		Fields: []*scanner.Field{
+			{Name: "Key", Type: m.Key},
+			{Name: "Value", Type: m.Value},
+		},
+	}
+	s.Nested = append(s.Nested, entry)
+
+	r.reporter().Report(&report.Diagnostic{
+		Severity: report.Warning,
+		Code:     report.MapAsList,
+		Message: fmt.Sprintf(
+			"field %q of struct %q of package %s can not be a map because %s, it will be a list of %s instead",
+			f.Name, s.Name, p.Path, reason, entry.Name,
+		),
+		Pos:  f.Pos,
+		Type: fmt.Sprintf("%s.%s", p.Path, s.Name),
+	})
+
+	typ := scanner.NewNamed(p.Path, entry.Name)
+	typ.SetRepeated(true)
+	typ.SetNullable(m.IsNullable())
+	return typ, nil
+}
+
+// invalidMapReason returns why the given map type can not be represented
+// as a protobuf map or an empty string if it can.
+func invalidMapReason(m *scanner.Map) string {
+	switch {
+	case m.IsRepeated():
+		return "it is repeated"
+	case !isValidMapKey(m.Key):
+		return fmt.Sprintf("its key type %s is not a valid map key", typeName(m.Key))
+	case m.Value.IsRepeated():
+		return "its values are repeated"
+	}
+
+	if _, ok := m.Value.(*scanner.Map); ok {
+		return "its values are maps"
+	}
+	return ""
+}
+
+// validMapKeys are the basic types that can be used as protobuf map keys.
+var validMapKeys = map[string]struct{}{
+	"bool":   struct{}{},
+	"string": struct{}{},
+	"int":    struct{}{},
+	"int8":   struct{}{},
+	"int16":  struct{}{},
+	"int32":  struct{}{},
+	"int64":  struct{}{},
+	"uint":   struct{}{},
+	"uint8":  struct{}{},
+	"uint16": struct{}{},
+	"uint32": struct{}{},
+	"uint64": struct{}{},
+	"byte":   struct{}{},
+	"rune":   struct{}{},
+}
+
+func isValidMapKey(t scanner.Type) bool {
+	b, ok := t.(*scanner.Basic)
+	if !ok || b.IsRepeated() {
+		return false
+	}
+
+	_, ok = validMapKeys[b.Name]
+	return ok
+}
+
+func typeName(t scanner.Type) string {
+	var name string
+	switch t := t.(type) {
 	case *scanner.Basic:
-		result = t
+		name = t.Name
+	case *scanner.Named:
+		name = t.String()
 	case *scanner.Map:
-		t.Key = r.resolveType(t.Key, info)
-		t.Value = r.resolveType(t.Value, info)
-		result = t
+		name = fmt.Sprintf("map[%s]%s", typeName(t.Key), typeName(t.Value))
+	}
+
+	if t.IsRepeated() {
+		return "[]" + name
 	}
+	return name
+}
 
-	return
+func mapError(part string, err error) error {
+	if err == nil {
+		return fmt.Errorf("its map %s type was intentionally ignored", part)
+	}
+	return fmt.Errorf("its map %s type can not be resolved: %s", part, err)
+}
+
+// resolveMarshaler returns the type used to represent the given named type,
+// which implements marshaling interfaces, or nil if it can not be
+// represented.
+func (r *Resolver) resolveMarshaler(t *scanner.Named) (scanner.Type, error) {
+	if r.IgnoreMarshalers {
+		return nil, nil
+	}
+
+	switch t.Marshaler {
+	case scanner.TextMarshaler:
+		return withFlags(scanner.NewBasic("string"), t), nil
+	case scanner.BinaryMarshaler:
+		if t.IsRepeated() {
+			return nil, fmt.Errorf("type %q of package %s is a repeated binary type, which is not supported", t.Name, t.Path)
+		}
+
+		typ := scanner.NewBasic("byte")
+		typ.SetRepeated(true)
+		return withFlags(typ, t), nil
+	}
+
+	return nil, fmt.Errorf("type %q of package %s has an unknown marshaler", t.Name, t.Path)
 }
 
 // Packages is a collection of scanned packages.
@@ -137,12 +501,59 @@ type PackagesInfo struct {
 	Packages map[string]struct{}
 }
 
-// AliasOf returns the alias of a given named type or nil if there is
-// no alias for that type.
-func (i *PackagesInfo) AliasOf(named *scanner.Named) scanner.Type {
-	alias, ok := i.Aliases[named.String()]
-	if !ok {
-		return nil
+// AliasOf returns the type the given named type is an alias of or nil if
+// it is not an alias. Chains of aliases, such as `type A B; type B []C`,
+// are followed until the actual type is found. The returned type is
+// always a copy with the repeated and nullable flags of the given named
+// type merged into it. An error is returned if the alias can not be
+// represented, such as a repeated type of a repeated type.
+func (i *PackagesInfo) AliasOf(named *scanner.Named) (scanner.Type, error) {
+	var (
+		result scanner.Type = named
+		seen                = make(map[string]struct{})
+	)
+
+	for {
+		n, ok := result.(*scanner.Named)
+		if !ok {
+			break
+		}
+
+		alias, ok := i.Aliases[n.String()]
+		if !ok {
+			break
+		}
+
+		if alias == nil {
+			return nil, fmt.Errorf("alias %s has an unsupported type", n)
+		}
+
+		if _, ok := seen[n.String()]; ok {
+			return nil, fmt.Errorf("alias %s refers to itself", n)
+		}
+		seen[n.String()] = struct{}{}
+
+		if alias.IsRepeated() && n.IsRepeated() {
+			return nil, fmt.Errorf("alias %s is a repeated type of a repeated type", n)
+		}
+
+		alias = alias.Clone()
+		alias.SetRepeated(alias.IsRepeated() || n.IsRepeated())
+		result = alias
+	}
+
+	if result == scanner.Type(named) {
+		return nil, nil
 	}
-	return alias
+
+	result.SetNullable(named.IsNullable())
+	return result, nil
+}
+
+// withFlags sets in typ the repeated and nullable flags of the original
+// type it replaces. If either of them is repeated, the result is repeated.
+func withFlags(typ, original scanner.Type) scanner.Type {
+	typ.SetRepeated(typ.IsRepeated() || original.IsRepeated())
+	typ.SetNullable(original.IsNullable())
+	return typ
 }
@@ -1,11 +1,13 @@
 package resolver
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"testing"
 
+	"github.com/src-d/proteus/report"
 	"github.com/src-d/proteus/scanner"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -75,6 +77,66 @@ func TestGetPackagesInfo(t *testing.T) {
 	require.True(t, ok)
 }
 
+func TestAliasOf(t *testing.T) {
+	info := &PackagesInfo{
+		Aliases: map[string]scanner.Type{
+			"foo.A":    scanner.NewNamed("foo", "B"),
+			"foo.B":    repeated(scanner.NewNamed("foo", "C")),
+			"foo.C":    scanner.NewBasic("int"),
+			"foo.List": repeated(scanner.NewBasic("int")),
+			"foo.Map":  scanner.NewMap(scanner.NewBasic("string"), scanner.NewNamed("foo", "List")),
+			"foo.Self": scanner.NewNamed("foo", "Self"),
+		},
+	}
+
+	cases := []struct {
+		name     string
+		typ      scanner.Type
+		expected scanner.Type
+		err      bool
+	}{
+		{"not an alias", scanner.NewNamed("foo", "D"), nil, false},
+		{"single alias", scanner.NewNamed("foo", "C"), scanner.NewBasic("int"), false},
+		{"alias chain", scanner.NewNamed("foo", "A"), repeated(scanner.NewBasic("int")), false},
+		{"repeated alias", repeated(scanner.NewNamed("foo", "C")), repeated(scanner.NewBasic("int")), false},
+		{"repeated of repeated", repeated(scanner.NewNamed("foo", "A")), nil, true},
+		{"composite alias", scanner.NewNamed("foo", "Map"), scanner.NewMap(scanner.NewBasic("string"), scanner.NewNamed("foo", "List")), false},
+		{"cyclic alias", scanner.NewNamed("foo", "Self"), nil, true},
+	}
+
+	for _, c := range cases {
+		alias, err := info.AliasOf(c.typ.(*scanner.Named))
+		if c.err {
+			require.NotNil(t, err, c.name)
+		} else {
+			require.Nil(t, err, c.name)
+		}
+		require.Equal(t, c.expected, alias, c.name)
+	}
+
+	a, _ := info.AliasOf(scanner.NewNamed("foo", "C").(*scanner.Named))
+	b, _ := info.AliasOf(scanner.NewNamed("foo", "C").(*scanner.Named))
+	require.False(t, a == b, "aliases should not be shared")
+	require.False(t, a == info.Aliases["foo.C"], "aliases should be copied")
+}
+
+func TestResolveCompositeAlias(t *testing.T) {
+	packages := Packages{
+		&scanner.Package{
+			Path: "foo",
+			Aliases: map[string]scanner.Type{
+				"foo.List": repeated(scanner.NewBasic("int")),
+				"foo.Map":  scanner.NewMap(scanner.NewBasic("string"), scanner.NewNamed("foo", "List")),
+			},
+		},
+	}
+
+	typ, err := New().resolveType(scanner.NewNamed("foo", "Map"), packages.Info())
+	require.Nil(t, err)
+	require.Equal(t, scanner.NewMap(scanner.NewBasic("string"), repeated(scanner.NewBasic("int"))), typ)
+	require.Equal(t, scanner.NewNamed("foo", "List"), packages[0].Aliases["foo.Map"].(*scanner.Map).Value, "alias should not be modified")
+}
+
 func TestResolver(t *testing.T) {
 	suite.Run(t, new(ResolverSuite))
 }
@@ -88,7 +150,7 @@ func (s *ResolverSuite) SetupSuite() {
 	s.r = New()
 }
 
-func (s *ResolverSuite) TestIsCustomType() {
+func (s *ResolverSuite) TestMapping() {
 	cases := []struct {
 		path   string
 		name   string
@@ -101,10 +163,29 @@ func (s *ResolverSuite) TestIsCustomType() {
 	}
 
 	for _, c := range cases {
-		s.Equal(c.result, s.r.isCustomType(&scanner.Named{nil, c.path, c.name}), "%s.%s", c.path, c.name)
+		s.Equal(c.result, s.r.Mapping(c.path+"."+c.name) != nil, "%s.%s", c.path, c.name)
 	}
 }
 
+func (s *ResolverSuite) TestConverters() {
+	r := New()
+	s.Equal(0, len(r.Converters()))
+
+	r.Register("net/url.URL", TypeMapping{
+		Type:   scanner.NewBasic("string"),
+		Encode: "github.com/foo/conv.URLToString",
+		Decode: "github.com/foo/conv.ParseURL",
+	})
+	r.Register("net.IP", TypeMapping{
+		Type:   scanner.NewBasic("string"),
+		Decode: "github.com/foo/conv.ParseURL",
+	})
+	s.Equal([]string{
+		"github.com/foo/conv.ParseURL",
+		"github.com/foo/conv.URLToString",
+	}, r.Converters())
+}
+
 func (s *ResolverSuite) TestResolve() {
 	sc, err := scanner.New(projectPath("fixtures"), projectPath("fixtures/subpkg"))
 	s.Nil(err)
@@ -115,7 +196,7 @@ func (s *ResolverSuite) TestResolve() {
 
 	pkg := pkgs[0]
 	s.assertStruct(pkg.Structs[0], "Bar", "Bar", "Baz")
-	s.assertStruct(pkg.Structs[1], "Foo", "Bar", "Baz", "IntList", "IntArray", "Map", "Timestamp", "Duration", "Aliased")
+	s.assertStruct(pkg.Structs[1], "Foo", "Bar", "Baz", "IntList", "IntArray", "Map", "Timestamp", "External", "Duration", "AliasQux", "Aliased")
 
 	foo := pkg.Structs[1]
 	aliasedType := foo.Fields[len(foo.Fields)-1].Type
@@ -125,6 +206,354 @@ func (s *ResolverSuite) TestResolve() {
 	s.Equal("int", basic.Name)
 }
 
+func (s *ResolverSuite) TestResolveMappings() {
+	sc, err := scanner.New(projectPath("fixtures"))
+	s.Nil(err)
+	pkgs, err := sc.Scan()
+	s.Nil(err)
+
+	r := New()
+	r.Register("net/url.URL", TypeMapping{
+		Type:   scanner.NewBasic("string"),
+		Encode: "net/url.URL.String",
+		Decode: "net/url.Parse",
+	})
+	r.Resolve(Packages(pkgs))
+
+	foo := pkgs[0].Structs[1]
+	s.assertStruct(foo, "Foo", "Bar", "Baz", "IntList", "IntArray", "Map", "Timestamp", "External", "Duration", "AliasQux", "Aliased")
+	s.Equal(scanner.NewBasic("string"), foo.Fields[6].Type)
+	s.Equal("time.Time", foo.Fields[5].Type.(*scanner.Named).String())
+}
+
+func (s *ResolverSuite) TestResolveMappingFlags() {
+	r := New()
+	r.Register("github.com/google/uuid.UUID", TypeMapping{Type: scanner.NewBasic("string")})
+
+	named := scanner.NewNamed("github.com/google/uuid", "UUID")
+	named.SetRepeated(true)
+	result, err := r.resolveType(named, Packages(nil).Info())
+	s.Nil(err)
+
+	expected := scanner.NewBasic("string")
+	expected.SetRepeated(true)
+	s.Equal(expected, result)
+	s.False(r.Mapping("github.com/google/uuid.UUID").Type.IsRepeated(), "mapping type should not be modified")
+}
+
+func (s *ResolverSuite) TestResolveMarshalers() {
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "marshalers")
+	overlay := map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package marshalers
+
+import (
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+)
+
+type Foo struct {
+	IP   net.IP
+	IPs  []net.IP
+	Int  *big.Int
+	URL  url.URL
+	URLs []url.URL
+	File os.File
+}
+`),
+	}
+
+	sc, err := scanner.NewWithOverlay(overlay, path)
+	s.Nil(err)
+	pkgs, err := sc.Scan()
+	s.Nil(err)
+
+	New().Resolve(Packages(pkgs))
+	foo := pkgs[0].Structs[0]
+	s.assertStruct(foo, "Foo", "IP", "IPs", "Int", "URL")
+
+	bytes := scanner.NewBasic("byte")
+	bytes.SetRepeated(true)
+	strings := scanner.NewBasic("string")
+	strings.SetRepeated(true)
+	s.Equal(scanner.NewBasic("string"), foo.Fields[0].Type)
+	s.Equal(strings, foo.Fields[1].Type)
+	s.Equal(scanner.NewBasic("string"), foo.Fields[2].Type)
+	s.Equal(bytes, foo.Fields[3].Type)
+
+	pkgs, err = sc.Scan()
+	s.Nil(err)
+	r := New()
+	r.IgnoreMarshalers = true
+	removals := r.Resolve(Packages(pkgs))
+	s.Equal(0, len(pkgs[0].Structs), "Foo should be removed as it has no fields")
+	for _, r := range removals {
+		s.Equal(r.Field != "File" && r.Field != "", r.Silent, "%s.%s", r.Struct, r.Field)
+	}
+}
+
+func (s *ResolverSuite) TestResolvePrune() {
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "prune")
+	overlay := map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package prune
+
+import "os"
+
+type Foo struct {
+	File os.File
+}
+
+type Bar struct {
+	Name string
+	Foo  *Foo
+	Foos map[string]Foo
+	Chs  map[string]chan int
+	Exc  Excluded
+	Conf struct {
+		File os.File
+	}
+}
+
+type Empty struct{}
+
+type Excluded struct {
+	Name string
+}
+`),
+	}
+
+	sc, err := scanner.NewWithOverlay(overlay, path)
+	s.Nil(err)
+	sc.Filter, err = scanner.NewTypeFilter(nil, []string{"Excluded"})
+	s.Nil(err)
+	pkgs, err := sc.Scan()
+	s.Nil(err)
+
+	removals := New().Resolve(Packages(pkgs))
+	s.Equal(2, len(pkgs[0].Structs))
+	s.assertStruct(pkgs[0].Structs[0], "Bar", "Name")
+	s.Equal(0, len(pkgs[0].Structs[0].Nested))
+	s.assertStruct(pkgs[0].Structs[1], "Empty")
+
+	var removed []string
+	for _, r := range removals {
+		removed = append(removed, r.Struct+"."+r.Field)
+	}
+	s.Equal([]string{
+		"Bar.Chs",
+		"Bar.Conf.File",
+		"Foo.File",
+		"Bar.Exc",
+		"Bar.Conf.",
+		"Foo.",
+		"Bar.Foo",
+		"Bar.Foos",
+		"Bar.Conf",
+	}, removed)
+}
+
+func (s *ResolverSuite) TestResolveSuppressions() {
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "suppressions")
+	overlay := map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package suppressions
+
+import "os"
+
+type Foo struct {
+	Name string
+	//proteus:ignore removed-field
+	File os.File
+	Conf map[float64]int //proteus:ignore map-as-list
+}
+
+//proteus:ignore removed-field removed-struct
+type Bar struct {
+	File os.File
+}
+
+type Baz struct {
+	File os.File
+}
+`),
+	}
+
+	var collector report.Collector
+	filter := report.NewSuppressionFilter(&collector)
+
+	sc, err := scanner.NewWithOverlay(overlay, path)
+	s.Nil(err)
+	sc.Reporter = filter
+	pkgs, err := sc.Scan()
+	s.Nil(err)
+
+	r := New()
+	r.Reporter = filter
+	removals := r.Resolve(Packages(pkgs))
+	s.Equal(5, len(removals))
+	filter.ReportUnused()
+
+	var reported []string
+	for _, d := range collector.Diagnostics() {
+		reported = append(reported, fmt.Sprintf("%s:%d", d.Code, d.Pos.Line))
+	}
+	s.Equal([]string{
+		"removed-field:18",
+		"removed-struct:17",
+		"removal-summary:0",
+	}, reported)
+}
+
+func (s *ResolverSuite) TestResolveFuncs() {
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "funcs")
+	overlay := map[string][]byte{
+		filepath.Join(path, "funcs.go"): []byte(`//proteus:service
+package funcs
+
+import (
+	"os"
+	"time"
+)
+
+type IDs []int
+
+type Empty struct {
+	File os.File
+}
+
+func Get(ids IDs, at time.Time) map[int]string {
+	return nil
+}
+
+func Open(f os.File) {}
+
+func Clear(e Empty) {}
+
+func Keys(m map[float64]int) {}
+`),
+	}
+
+	sc, err := scanner.NewWithOverlay(overlay, path)
+	s.Nil(err)
+	pkgs, err := sc.Scan()
+	s.Nil(err)
+	s.Equal(4, len(pkgs[0].Funcs))
+
+	var collector report.Collector
+	r := New()
+	r.Reporter = &collector
+	r.Resolve(Packages(pkgs))
+
+	funcs := pkgs[0].Funcs
+	s.Equal(1, len(funcs))
+	s.Equal("Get", funcs[0].Name)
+	s.Equal(repeated(scanner.NewBasic("int")), funcs[0].Params[0].Type)
+	s.Equal("time.Time", funcs[0].Params[1].Type.(*scanner.Named).String())
+
+	var removed []string
+	for _, d := range collector.Diagnostics() {
+		if d.Code == report.RemovedRPC {
+			removed = append(removed, d.Type)
+		}
+	}
+	s.Equal([]string{
+		pkgs[0].Path + ".Keys",
+		pkgs[0].Path + ".Open",
+		pkgs[0].Path + ".Clear",
+	}, removed)
+}
+
+func (s *ResolverSuite) TestResolveMapKeys() {
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "mapkeys")
+	overlay := map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package mapkeys
+
+type Point struct {
+	X, Y int
+}
+
+type Kind int
+
+const (
+	A Kind = iota
+	B
+)
+
+type Foo struct {
+	Valid    map[string]int
+	IntKeys  map[uint32]*Point
+	Floats   map[float64]int
+	Points   map[Point]string
+	Kinds    map[Kind]string
+	Lists    map[string][]int
+	Nested   map[int]map[int]int
+	Deep     map[string]map[float64]int
+	Repeated []map[string]int
+}
+`),
+	}
+
+	sc, err := scanner.NewWithOverlay(overlay, path)
+	s.Nil(err)
+	pkgs, err := sc.Scan()
+	s.Nil(err)
+
+	var collector report.Collector
+	r := New()
+	r.Reporter = &collector
+	r.Resolve(Packages(pkgs))
+	foo := pkgs[0].Structs[0]
+	s.assertStruct(foo, "Foo", "Valid", "IntKeys", "Floats", "Points", "Kinds", "Lists", "Nested", "Deep")
+
+	pkg := pkgs[0].Path
+	s.IsType(new(scanner.Map), foo.Fields[0].Type)
+	s.IsType(new(scanner.Map), foo.Fields[1].Type)
+	for i, name := range []string{"Floats", "Points", "Kinds", "Lists", "Nested", "Deep"} {
+		s.Equal(repeated(scanner.NewNamed(pkg, "Foo."+name+"Entry")), foo.Fields[i+2].Type, name)
+		s.assertStruct(foo.Nested[i], "Foo."+name+"Entry", "Key", "Value")
+	}
+
+	s.Equal(scanner.NewBasic("float64"), foo.Nested[0].Fields[0].Type)
+	s.Equal(scanner.NewNamed(pkg, "Point"), foo.Nested[1].Fields[0].Type)
+	s.Equal(repeated(scanner.NewBasic("int")), foo.Nested[3].Fields[1].Type)
+	s.IsType(new(scanner.Map), foo.Nested[4].Fields[1].Type)
+
+	deep := foo.Nested[5]
+	s.Equal(repeated(scanner.NewNamed(pkg, "Foo.DeepEntry.ValueEntry")), deep.Fields[1].Type)
+	s.Equal(1, len(deep.Nested))
+	s.assertStruct(deep.Nested[0], "Foo.DeepEntry.ValueEntry", "Key", "Value")
+	s.Equal(scanner.NewBasic("float64"), deep.Nested[0].Fields[0].Type)
+
+	var codes []report.Code
+	for _, d := range collector.Diagnostics() {
+		codes = append(codes, d.Code)
+	}
+	s.Equal([]report.Code{
+		report.MapAsList,
+		report.MapAsList,
+		report.MapAsList,
+		report.MapAsList,
+		report.MapAsList,
+		report.MapAsList,
+		report.MapAsList,
+		report.RemovedField,
+		report.RemovalSummary,
+	}, codes)
+
+	d := collector.Diagnostics()[0]
+	s.Equal(report.Warning, d.Severity)
+	s.Equal(filepath.Join(path, "foo.go"), d.Pos.Filename)
+	s.Equal(17, d.Pos.Line)
+	s.Equal(pkg+".Foo", d.Type)
+
+	d = collector.Diagnostics()[6]
+	s.Equal(pkg+".Foo.DeepEntry", d.Type)
+
+	d = collector.Diagnostics()[7]
+	s.Equal(23, d.Pos.Line)
+	s.Equal(1, collector.Count(report.Info))
+}
+
 func (s *ResolverSuite) assertStruct(st *scanner.Struct, name string, fields ...string) {
 	s.Equal(name, st.Name, "struct name")
 	s.Equal(len(fields), len(st.Fields), "should have same struct fields")
@@ -142,6 +571,11 @@ func assertStrSet(t *testing.T, set map[string]struct{}, expected ...string) {
 	require.Equal(t, expected, vals)
 }
 
+func repeated(t scanner.Type) scanner.Type {
+	t.SetRepeated(true)
+	return t
+}
+
 func enum(name string, values ...string) *scanner.Enum {
 	return &scanner.Enum{
 		Name:   name,
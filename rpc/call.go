@@ -0,0 +1,274 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Call calls the given function, which is usually a function or method
+// exposed as an RPC, with the given arguments converted into the types of
+// its parameters, and converts its results into the values pointed by the
+// given results, all of them with Convert. If the last result of the
+// function is an error and there is no destination for it, it is returned
+// as a status error, as described in Error.
+//
+// Channel parameters and results are streamed with the values returned by
+// ClientStream and ServerStream, which are given in their place instead of
+// a value or a destination.
+//
+// A context.Context argument given to a context.Context parameter is
+// cancelled once Call returns, including when streaming a result fails,
+// so the function producing the values of a result channel should stop
+// when it is done.
+//
+// The arguments that can not be converted are reported with the code
+// codes.InvalidArgument and the results with codes.Internal.
+func Call(fn interface{}, args []interface{}, results []interface{}) error {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return status.Errorf(codes.Internal, "rpc: can not call %s", t)
+	}
+
+	hasError := t.NumOut() == len(results)+1 && t.Out(t.NumOut()-1) == errorType
+	if t.NumIn() != len(args) || (t.NumOut() != len(results) && !hasError) {
+		return status.Errorf(codes.Internal, "rpc: can not call %s with %d arguments and %d results", t, len(args), len(results))
+	}
+
+	var (
+		in      = make([]reflect.Value, len(args))
+		streams []*stream
+	)
+	defer func() {
+		for _, s := range streams {
+			s.stop()
+		}
+	}()
+
+	for i, arg := range args {
+		if s, ok := arg.(*stream); ok {
+			if err := s.startParam(t.In(i)); err != nil {
+				return err
+			}
+			streams = append(streams, s)
+			in[i] = s.ch
+			continue
+		}
+
+		if ctx, ok := arg.(context.Context); ok && t.In(i) == contextType {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			in[i] = reflect.ValueOf(ctx)
+			continue
+		}
+
+		in[i] = reflect.New(t.In(i)).Elem()
+		if err := convert(reflect.ValueOf(arg), in[i]); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid argument #%d: %s", i+1, err)
+		}
+	}
+
+	out := v.Call(in)
+	for _, s := range streams {
+		s.stop()
+	}
+
+	if hasError {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return Error(err)
+		}
+	}
+
+	for _, s := range streams {
+		if err := s.firstErr(); err != nil {
+			return Error(err)
+		}
+	}
+
+	for i, r := range results {
+		if s, ok := r.(*stream); ok {
+			if err := s.sendResult(out[i]); err != nil {
+				return Error(err)
+			}
+			continue
+		}
+
+		dst := reflect.ValueOf(r)
+		if dst.Kind() != reflect.Ptr || dst.IsNil() {
+			return status.Errorf(codes.Internal, "rpc: invalid destination %T for result #%d", r, i+1)
+		}
+
+		if err := convert(out[i], dst.Elem()); err != nil {
+			return status.Errorf(codes.Internal, "invalid result #%d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// stream is a channel parameter or result of a function called with Call
+// whose values are streamed.
+type stream struct {
+	recv func() (interface{}, error)
+	send func(interface{}) error
+
+	ch   reflect.Value
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+
+	mut sync.Mutex
+	err error
+}
+
+// ClientStream returns the argument of a `<-chan T` parameter of a
+// function called with Call, which receives the values returned by the
+// given function converted into T. The channel is closed when it returns
+// io.EOF or any other error, in which case it is returned by Call.
+func ClientStream(recv func() (interface{}, error)) interface{} {
+	return &stream{recv: recv}
+}
+
+// ServerStream returns the argument of a `chan<- T` parameter or the
+// destination of a `<-chan T` result of a function called with Call,
+// whose values are passed to the given function. A parameter channel must
+// not be used once the function returns, as it is closed. A result channel
+// is streamed until it is closed by the function. The first error returned
+// by the given function is returned by Call.
+func ServerStream(send func(interface{}) error) interface{} {
+	return &stream{send: send}
+}
+
+// firstErr returns the first error found while streaming.
+func (s *stream) firstErr() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.err
+}
+
+func (s *stream) setErr(err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// startParam creates the channel of the parameter with the given type and
+// starts streaming its values.
+func (s *stream) startParam(t reflect.Type) error {
+	if t.Kind() != reflect.Chan {
+		return status.Errorf(codes.Internal, "rpc: can not stream a parameter of type %s", t)
+	}
+
+	s.ch = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, t.Elem()), 0)
+	s.done = make(chan struct{})
+
+	switch {
+	case s.recv != nil && t.ChanDir()&reflect.RecvDir != 0:
+		go s.receive()
+	case s.send != nil && t.ChanDir()&reflect.SendDir != 0:
+		s.wg.Add(1)
+		go s.sendParam()
+	default:
+		return status.Errorf(codes.Internal, "rpc: can not stream a parameter of type %s in this direction", t)
+	}
+	return nil
+}
+
+// receive sends the received values to the channel until there are no
+// more or the function returns.
+func (s *stream) receive() {
+	defer s.ch.Close()
+
+	for {
+		msg, err := s.recv()
+		if err != nil {
+			if err != io.EOF {
+				s.setErr(err)
+			}
+			return
+		}
+
+		v := reflect.New(s.ch.Type().Elem()).Elem()
+		if err := convert(reflect.ValueOf(msg), v); err != nil {
+			s.setErr(status.Errorf(codes.InvalidArgument, "invalid streamed value: %s", err))
+			return
+		}
+
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: s.ch, Send: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.done)},
+		})
+		if chosen == 1 {
+			return
+		}
+	}
+}
+
+// sendParam sends the values sent by the function to the channel until
+// it is closed. Once sending fails, the rest of values are discarded, so
+// the function is not blocked.
+func (s *stream) sendParam() {
+	defer s.wg.Done()
+	for {
+		v, ok := s.ch.Recv()
+		if !ok {
+			return
+		}
+
+		if s.firstErr() == nil {
+			if err := s.send(v.Interface()); err != nil {
+				s.setErr(err)
+			}
+		}
+	}
+}
+
+// stop stops streaming the parameter once the function returns, waiting
+// for the values sent by the function to be sent. Receiving values is not
+// waited for, as it only stops when the RPC ends.
+func (s *stream) stop() {
+	s.once.Do(func() {
+		if !s.ch.IsValid() {
+			return
+		}
+
+		close(s.done)
+		if s.send != nil {
+			s.ch.Close()
+			s.wg.Wait()
+		}
+	})
+}
+
+// sendResult sends all the values of the given result channel until it is
+// closed. The first error sending one is returned right away, without
+// waiting for the channel to be closed, as the function sending them is
+// told to stop by cancelling its context once Call returns.
+func (s *stream) sendResult(ch reflect.Value) error {
+	if s.send == nil || ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return status.Errorf(codes.Internal, "rpc: can not stream a result of type %s", ch.Type())
+	}
+
+	if ch.IsNil() {
+		return nil
+	}
+
+	for {
+		v, ok := ch.Recv()
+		if !ok {
+			return nil
+		}
+
+		if err := s.send(v.Interface()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func find(ctx context.Context, name string, kind Kind) (*User, error) {
+	if name == "" {
+		return nil, errors.New("empty name")
+	}
+	return &User{Name: name, Kind: kind}, nil
+}
+
+func TestCall(t *testing.T) {
+	require := require.New(t)
+
+	var result *pbUser
+	err := Call(find, []interface{}{context.Background(), "jane", int32(1)}, []interface{}{&result})
+	require.Nil(err)
+	require.Equal("jane", result.Name)
+	require.Equal(int32(1), result.Kind)
+
+	err = Call(find, []interface{}{context.Background(), "", int32(1)}, []interface{}{&result})
+	require.Equal(codes.Unknown, status.Code(err))
+	require.Equal("empty name", status.Convert(err).Message())
+
+	err = Call(find, []interface{}{context.Background(), "jane", "admin"}, []interface{}{&result})
+	require.Equal(codes.InvalidArgument, status.Code(err))
+
+	err = Call(find, []interface{}{"jane"}, []interface{}{&result})
+	require.Equal(codes.Internal, status.Code(err))
+
+	var name string
+	err = Call(find, []interface{}{context.Background(), "jane", int32(1)}, []interface{}{&name})
+	require.Equal(codes.Internal, status.Code(err))
+}
+
+func recvAll(values ...interface{}) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if len(values) == 0 {
+			return nil, io.EOF
+		}
+
+		v := values[0]
+		values = values[1:]
+		return v, nil
+	}
+}
+
+func TestCallClientStream(t *testing.T) {
+	require := require.New(t)
+
+	sum := func(nums <-chan int) int {
+		var total int
+		for n := range nums {
+			total += n
+		}
+		return total
+	}
+
+	var total int64
+	err := Call(sum, []interface{}{ClientStream(recvAll(int64(1), int64(2), int64(3)))}, []interface{}{&total})
+	require.Nil(err)
+	require.Equal(int64(6), total)
+
+	failing := func() (interface{}, error) {
+		return nil, status.Error(codes.Aborted, "aborted")
+	}
+	err = Call(sum, []interface{}{ClientStream(failing)}, []interface{}{&total})
+	require.Equal(codes.Aborted, status.Code(err))
+
+	first := func(nums <-chan int) int {
+		return <-nums
+	}
+	err = Call(first, []interface{}{ClientStream(recvAll(int64(1), int64(2), int64(3)))}, []interface{}{&total})
+	require.Nil(err)
+	require.Equal(int64(1), total)
+}
+
+func TestCallServerStream(t *testing.T) {
+	require := require.New(t)
+
+	var sent []int64
+	send := func(v interface{}) error {
+		var n int64
+		if err := Convert(v, &n); err != nil {
+			return err
+		}
+
+		if n > 2 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		sent = append(sent, n)
+		return nil
+	}
+
+	count := func(n int, out chan<- int) {
+		for i := 0; i < n; i++ {
+			out <- i
+		}
+	}
+	require.Nil(Call(count, []interface{}{int64(3), ServerStream(send)}, nil))
+	require.Equal([]int64{0, 1, 2}, sent)
+
+	sent = nil
+	err := Call(count, []interface{}{int64(5), ServerStream(send)}, nil)
+	require.Equal(codes.Unavailable, status.Code(err))
+	require.Equal([]int64{0, 1, 2}, sent)
+
+	feed := func(n int) (<-chan int, error) {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 0; i < n; i++ {
+				ch <- i
+			}
+		}()
+		return ch, nil
+	}
+
+	sent = nil
+	require.Nil(Call(feed, []interface{}{int64(2)}, []interface{}{ServerStream(send)}))
+	require.Equal([]int64{0, 1}, sent)
+
+	stopped := make(chan struct{})
+	feedAll := func(ctx context.Context, n int) (<-chan int, error) {
+		ch := make(chan int)
+		go func() {
+			defer close(stopped)
+			for i := 0; i < n; i++ {
+				select {
+				case ch <- i:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return ch, nil
+	}
+
+	sent = nil
+	err = Call(feedAll, []interface{}{context.Background(), int64(5)}, []interface{}{ServerStream(send)})
+	require.Equal(codes.Unavailable, status.Code(err))
+	require.Equal([]int64{0, 1, 2}, sent)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.Fail("the function must be cancelled after the failed value")
+	}
+
+	echo := func(in <-chan string, out chan<- string) {
+		for s := range in {
+			out <- s + "!"
+		}
+	}
+
+	var echoed []string
+	err = Call(echo, []interface{}{
+		ClientStream(recvAll("a", "b")),
+		ServerStream(func(v interface{}) error {
+			echoed = append(echoed, v.(string))
+			return nil
+		}),
+	}, nil)
+	require.Nil(err)
+	require.Equal([]string{"a!", "b!"}, echoed)
+}
@@ -0,0 +1,158 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// ConvertAll converts every one of the given values into the value pointed
+// by the destination at the same position with Convert. The destinations
+// are only set if all the values can be converted.
+func ConvertAll(srcs []interface{}, dsts []interface{}) error {
+	if len(srcs) != len(dsts) {
+		return fmt.Errorf("rpc: can not convert %d values into %d destinations", len(srcs), len(dsts))
+	}
+
+	var values = make([]reflect.Value, len(dsts))
+	for i, dst := range dsts {
+		v := reflect.ValueOf(dst)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("rpc: invalid destination %T for value #%d", dst, i+1)
+		}
+
+		values[i] = reflect.New(v.Type().Elem()).Elem()
+		if err := convert(reflect.ValueOf(srcs[i]), values[i]); err != nil {
+			return fmt.Errorf("invalid value #%d: %s", i+1, err)
+		}
+	}
+
+	for i, dst := range dsts {
+		reflect.ValueOf(dst).Elem().Set(values[i])
+	}
+	return nil
+}
+
+// SendStream passes the values received from the given channel, which is
+// usually a `<-chan T` argument of a client, to the given function until
+// the channel is closed. It returns the first error returned by the
+// function or the error of the context if it is done first. An io.EOF
+// error stops sending without error, as it means the RPC ended and its
+// status is returned when receiving.
+func SendStream(ctx context.Context, ch interface{}, send func(interface{}) error) error {
+	c := reflect.ValueOf(ch)
+	if c.Kind() != reflect.Chan || c.Type().ChanDir()&reflect.RecvDir == 0 {
+		return fmt.Errorf("rpc: can not receive values to send from %T", ch)
+	}
+
+	for {
+		chosen, v, ok := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: c},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		})
+		switch {
+		case chosen == 1:
+			return ctx.Err()
+		case !ok:
+			return nil
+		}
+
+		if err := send(v.Interface()); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ReceiveStream sends the values returned by the given function to the
+// given channel, which is usually a `chan<- T` argument of a client, once
+// they are converted into T with Convert. It returns nil once the function
+// returns io.EOF, or the first error found. The channel is not closed.
+func ReceiveStream(ctx context.Context, recv func() (interface{}, error), ch interface{}) error {
+	c := reflect.ValueOf(ch)
+	if c.Kind() != reflect.Chan || c.Type().ChanDir()&reflect.SendDir == 0 {
+		return fmt.Errorf("rpc: can not send the received values to %T", ch)
+	}
+
+	for {
+		msg, err := recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		v := reflect.New(c.Type().Elem()).Elem()
+		if err := convert(reflect.ValueOf(msg), v); err != nil {
+			return fmt.Errorf("invalid streamed value: %s", err)
+		}
+
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: c, Send: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		})
+		if chosen == 1 {
+			return ctx.Err()
+		}
+	}
+}
+
+// Exchange streams in both directions at once: it sends the values of the
+// in channel with SendStream, calling closeSend once it is closed, and it
+// sends the received values to the out channel with ReceiveStream. The
+// given context must be the context of the RPC and cancel must cancel it,
+// which is done once receiving ends, so sending stops if it did not end
+// yet, or as soon as either side fails, so the other one stops. It returns
+// the first error found on either side.
+func Exchange(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	in interface{},
+	send func(interface{}) error,
+	closeSend func() error,
+	recv func() (interface{}, error),
+	out interface{},
+) error {
+	var (
+		mut   sync.Mutex
+		first error
+		ended bool
+		done  = make(chan struct{})
+	)
+	fail := func(err error) {
+		mut.Lock()
+		if first == nil && !ended {
+			first = err
+		}
+		mut.Unlock()
+		cancel()
+	}
+
+	go func() {
+		defer close(done)
+		err := SendStream(ctx, in, send)
+		if err == nil {
+			err = closeSend()
+		}
+
+		if err != nil {
+			fail(err)
+		}
+	}()
+
+	if err := ReceiveStream(ctx, recv, out); err != nil {
+		fail(err)
+	}
+
+	mut.Lock()
+	ended = true
+	mut.Unlock()
+
+	cancel()
+	<-done
+	return first
+}
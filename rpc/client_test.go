@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAll(t *testing.T) {
+	require := require.New(t)
+
+	var (
+		name string
+		kind Kind
+	)
+	require.Nil(ConvertAll([]interface{}{"jane", int32(1)}, []interface{}{&name, &kind}))
+	require.Equal("jane", name)
+	require.Equal(Kind(1), kind)
+
+	err := ConvertAll([]interface{}{"john", "admin"}, []interface{}{&name, &kind})
+	require.NotNil(err)
+	require.Equal("jane", name, "destinations are not set if any value fails")
+
+	require.NotNil(ConvertAll([]interface{}{"john"}, []interface{}{name}))
+	require.NotNil(ConvertAll([]interface{}{"john"}, nil))
+}
+
+func TestSendStream(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	var sent []interface{}
+	require.Nil(SendStream(ctx, (<-chan int)(ch), func(v interface{}) error {
+		sent = append(sent, v)
+		return nil
+	}))
+	require.Equal([]interface{}{1, 2}, sent)
+
+	ch = make(chan int, 1)
+	ch <- 1
+	require.Nil(SendStream(ctx, ch, func(interface{}) error {
+		return io.EOF
+	}), "the end of the RPC stops sending")
+
+	ch <- 1
+	err := errors.New("broken")
+	require.Equal(err, SendStream(ctx, ch, func(interface{}) error {
+		return err
+	}))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(context.Canceled, SendStream(ctx, make(chan int), nil))
+
+	require.NotNil(SendStream(ctx, make(chan<- int), nil))
+}
+
+func TestReceiveStream(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ch := make(chan Kind, 2)
+	require.Nil(ReceiveStream(ctx, recvAll(int32(1), int64(2)), (chan<- Kind)(ch)))
+	close(ch)
+
+	var kinds []Kind
+	for k := range ch {
+		kinds = append(kinds, k)
+	}
+	require.Equal([]Kind{1, 2}, kinds)
+
+	require.NotNil(ReceiveStream(ctx, recvAll("admin"), make(chan Kind, 1)))
+
+	err := errors.New("broken")
+	require.Equal(err, ReceiveStream(ctx, func() (interface{}, error) {
+		return nil, err
+	}, make(chan Kind)))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(context.Canceled, ReceiveStream(ctx, recvAll(int32(1)), make(chan Kind)))
+
+	require.NotNil(ReceiveStream(ctx, recvAll(), make(<-chan Kind)))
+}
+
+// echoStream is a bidirectional stream whose server sends back every
+// received value until the client closes its side or the context is done.
+type echoStream struct {
+	ctx    context.Context
+	values chan interface{}
+}
+
+func newEchoStream(ctx context.Context) *echoStream {
+	return &echoStream{ctx: ctx, values: make(chan interface{})}
+}
+
+func (s *echoStream) send(v interface{}) error {
+	select {
+	case s.values <- v:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *echoStream) closeSend() error {
+	close(s.values)
+	return nil
+}
+
+func (s *echoStream) recv() (interface{}, error) {
+	select {
+	case v, ok := <-s.values:
+		if !ok {
+			return nil, io.EOF
+		}
+		return v, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func TestExchange(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newEchoStream(ctx)
+
+	in, out := make(chan string, 2), make(chan string, 2)
+	in <- "foo"
+	in <- "bar"
+	close(in)
+	require.Nil(Exchange(ctx, cancel, in, s.send, s.closeSend, s.recv, out))
+	require.Equal("foo", <-out)
+	require.Equal("bar", <-out)
+	require.Equal(context.Canceled, ctx.Err())
+}
+
+func TestExchangeSendError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newEchoStream(ctx)
+
+	err := errors.New("broken")
+	in := make(chan string, 1)
+	in <- "foo"
+	require.Equal(t, err, Exchange(ctx, cancel, in, func(interface{}) error {
+		return err
+	}, s.closeSend, s.recv, make(chan string)))
+}
+
+func TestExchangeServerEnd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The input channel is never closed, but the server ending the stream
+	// stops sending its values.
+	require.Nil(t, Exchange(ctx, cancel, make(chan string), func(interface{}) error {
+		return nil
+	}, func() error {
+		return nil
+	}, recvAll(), make(chan string)))
+}
@@ -0,0 +1,531 @@
+package rpc
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	errorType           = reflect.TypeOf((*error)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timestampType       = reflect.TypeOf((*timestamppb.Timestamp)(nil))
+	durationpbType      = reflect.TypeOf((*durationpb.Duration)(nil))
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binMarshalerType    = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binUnmarshalerType  = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// converter is a function registered to convert values of a type into
+// values of another.
+type converter struct {
+	fn       reflect.Value
+	in, out  reflect.Type
+	hasError bool
+}
+
+var converters = struct {
+	sync.RWMutex
+	list []*converter
+}{}
+
+// RegisterConverter registers the given function, which must have a
+// signature like `func(A) B` or `func(A) (B, error)`, to convert values of
+// type A into values of type B. It is used by Convert for the types that
+// can not be converted otherwise, such as the types of packages that are
+// not scanned and are mapped to other types. It panics if the function
+// does not have a valid signature.
+func RegisterConverter(fn interface{}) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.IsVariadic() ||
+		t.NumOut() < 1 || t.NumOut() > 2 ||
+		(t.NumOut() == 2 && t.Out(1) != errorType) {
+		panic(fmt.Sprintf("rpc: invalid converter of type %s", t))
+	}
+
+	converters.Lock()
+	defer converters.Unlock()
+	converters.list = append(converters.list, &converter{
+		fn:       v,
+		in:       t.In(0),
+		out:      t.Out(0),
+		hasError: t.NumOut() == 2,
+	})
+}
+
+// findConverter returns the converter registered for the given types or
+// nil if there is none. A converter whose input type is the source type
+// and whose output type is not the destination one is also returned if the
+// source type is defined in a package, and vice versa, as its output can
+// be converted to the destination type.
+func findConverter(src, dst reflect.Type) *converter {
+	converters.RLock()
+	defer converters.RUnlock()
+
+	var found *converter
+	for _, c := range converters.list {
+		switch {
+		case c.in == src && c.out == dst:
+			return c
+		case found == nil && c.in == src && src.PkgPath() != "":
+			found = c
+		case found == nil && c.out == dst && dst.PkgPath() != "":
+			found = c
+		}
+	}
+	return found
+}
+
+func (c *converter) convert(src, dst reflect.Value) error {
+	in := reflect.New(c.in).Elem()
+	if err := convert(src, in); err != nil {
+		return err
+	}
+
+	out := c.fn.Call([]reflect.Value{in})
+	if c.hasError && !out[1].IsNil() {
+		return out[1].Interface().(error)
+	}
+	return convert(out[0], dst)
+}
+
+// Convert converts the given value into the value pointed by dst, which
+// usually have different types, such as an original Go type and the type
+// generated for it by protoc. Values are converted as follows:
+//
+//   - Values assignable to the destination are assigned.
+//   - Values of types registered with RegisterConverter are converted with
+//     the registered function.
+//   - Structs are converted field by field. Fields are matched by name,
+//     ignoring case and underscores, so `UserID` matches `UserId`. Fields
+//     without a match are left as they are.
+//   - Pointers, slices, arrays and maps are converted element by element.
+//     Maps are also converted to and from slices of structs with `Key` and
+//     `Value` fields, which represent the maps that can not be maps in
+//     protobuf.
+//   - Numbers are converted to other numeric types, as long as they are
+//     not truncated. Enums are converted by value.
+//   - time.Time and time.Duration are converted to and from their
+//     protobuf well known types.
+//   - Types implementing the text or binary marshaling interfaces of the
+//     encoding package are converted to and from strings and bytes.
+func Convert(src, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, not %T", dst)
+	}
+	return convert(reflect.ValueOf(src), v.Elem())
+}
+
+func convert(src, dst reflect.Value) error {
+	if !src.IsValid() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	st, dt := src.Type(), dst.Type()
+	if st.AssignableTo(dt) {
+		dst.Set(src)
+		return nil
+	}
+
+	// Nil values are never passed to converters nor marshalers, which may
+	// not expect them.
+	if (st.Kind() == reflect.Interface || st.Kind() == reflect.Ptr) && src.IsNil() {
+		dst.Set(reflect.Zero(dt))
+		return nil
+	}
+
+	if c := findConverter(st, dt); c != nil {
+		return c.convert(src, dst)
+	}
+
+	if ok, err := convertWellKnown(src, dst); ok {
+		return err
+	}
+
+	if ok, err := convertMarshaler(src, dst); ok {
+		return err
+	}
+
+	switch {
+	case st.Kind() == reflect.Interface, st.Kind() == reflect.Ptr:
+		return convert(src.Elem(), dst)
+	case dt.Kind() == reflect.Ptr:
+		v := reflect.New(dt.Elem())
+		if err := convert(src, v.Elem()); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	switch {
+	case isNumber(st.Kind()) && isNumber(dt.Kind()):
+		return convertNumber(src, dst)
+	case st.Kind() == reflect.String && dt.Kind() == reflect.String,
+		st.Kind() == reflect.Bool && dt.Kind() == reflect.Bool,
+		isBytes(st) && isBytes(dt):
+		dst.Set(src.Convert(dt))
+		return nil
+	case st.Kind() == reflect.Struct && dt.Kind() == reflect.Struct:
+		return convertStruct(src, dst)
+	case st.Kind() == reflect.Map && dt.Kind() == reflect.Map:
+		return convertMap(src, dst)
+	case st.Kind() == reflect.Map && isEntries(dt):
+		return convertMapToEntries(src, dst)
+	case isEntries(st) && dt.Kind() == reflect.Map:
+		return convertEntriesToMap(src, dst)
+	case isList(st.Kind()) && isList(dt.Kind()):
+		return convertList(src, dst)
+	}
+
+	return fmt.Errorf("can not convert %s to %s", st, dt)
+}
+
+func convertWellKnown(src, dst reflect.Value) (bool, error) {
+	switch st, dt := src.Type(), dst.Type(); {
+	case st == timeType && dt == timestampType:
+		dst.Set(reflect.ValueOf(timestamppb.New(src.Interface().(time.Time))))
+	case st == timestampType && dt == timeType:
+		var t time.Time
+		if ts := src.Interface().(*timestamppb.Timestamp); ts != nil {
+			t = ts.AsTime()
+		}
+		dst.Set(reflect.ValueOf(t))
+	case st == durationType && dt == durationpbType:
+		dst.Set(reflect.ValueOf(durationpb.New(src.Interface().(time.Duration))))
+	case st == durationpbType && dt == durationType:
+		var d time.Duration
+		if pb := src.Interface().(*durationpb.Duration); pb != nil {
+			d = pb.AsDuration()
+		}
+		dst.Set(reflect.ValueOf(d))
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// convertMarshaler converts values of types implementing the marshaling
+// interfaces of the encoding package to and from strings and bytes. The
+// text interfaces are preferred, as they are by the scanner.
+func convertMarshaler(src, dst reflect.Value) (bool, error) {
+	st, dt := src.Type(), dst.Type()
+	switch {
+	case dt.Kind() == reflect.String && st.Kind() != reflect.String && implements(st, textMarshalerType):
+		text, err := addressable(src).Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return true, err
+		}
+		dst.SetString(string(text))
+	case isBytes(dt) && !isBytes(st) && implements(st, binMarshalerType) && !implements(st, textMarshalerType):
+		data, err := addressable(src).Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return true, err
+		}
+		dst.SetBytes(data)
+	case st.Kind() == reflect.String && dt.Kind() != reflect.String && implements(dt, textUnmarshalerType):
+		v := reflect.New(dt)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(src.String())); err != nil {
+			return true, err
+		}
+		dst.Set(v.Elem())
+	case isBytes(st) && !isBytes(dt) && implements(dt, binUnmarshalerType) && !implements(dt, textUnmarshalerType):
+		v := reflect.New(dt)
+		if err := v.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(src.Bytes()); err != nil {
+			return true, err
+		}
+		dst.Set(v.Elem())
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// implements reports whether the type or a pointer to it implements the
+// given interface.
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+// addressable returns the given value or an addressable copy of it, so
+// methods with pointer receivers can be called.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+func isList(k reflect.Kind) bool {
+	return k == reflect.Slice || k == reflect.Array
+}
+
+func convertNumber(src, dst reflect.Value) error {
+	var overflow bool
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			overflow = dst.OverflowInt(src.Int())
+		case reflect.Float32, reflect.Float64:
+			overflow = src.Float() != float64(int64(src.Float())) || dst.OverflowInt(int64(src.Float()))
+		default:
+			overflow = src.Uint() > 1<<63-1 || dst.OverflowInt(int64(src.Uint()))
+		}
+	case reflect.Float32, reflect.Float64:
+		switch src.Kind() {
+		case reflect.Float32, reflect.Float64:
+			overflow = dst.OverflowFloat(src.Float())
+		}
+	default:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			overflow = src.Int() < 0 || dst.OverflowUint(uint64(src.Int()))
+		case reflect.Float32, reflect.Float64:
+			overflow = src.Float() < 0 || src.Float() != float64(uint64(src.Float())) || dst.OverflowUint(uint64(src.Float()))
+		default:
+			overflow = dst.OverflowUint(src.Uint())
+		}
+	}
+
+	if overflow {
+		return fmt.Errorf("value %v overflows %s", src.Interface(), dst.Type())
+	}
+
+	dst.Set(src.Convert(dst.Type()))
+	return nil
+}
+
+func convertList(src, dst reflect.Value) error {
+	if src.Kind() == reflect.Slice && src.IsNil() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	n := src.Len()
+	if dst.Kind() == reflect.Slice {
+		dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+	} else if n > dst.Len() {
+		return fmt.Errorf("can not convert %d values to %s", n, dst.Type())
+	}
+
+	for i := 0; i < n; i++ {
+		if err := convert(src.Index(i), dst.Index(i)); err != nil {
+			return fmt.Errorf("[%d]: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func convertMap(src, dst reflect.Value) error {
+	if src.IsNil() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	dt := dst.Type()
+	m := reflect.MakeMapWithSize(dt, src.Len())
+	iter := src.MapRange()
+	for iter.Next() {
+		key, val := reflect.New(dt.Key()).Elem(), reflect.New(dt.Elem()).Elem()
+		if err := convert(iter.Key(), key); err != nil {
+			return fmt.Errorf("key %v: %s", iter.Key().Interface(), err)
+		}
+
+		if err := convert(iter.Value(), val); err != nil {
+			return fmt.Errorf("[%v]: %s", iter.Key().Interface(), err)
+		}
+		m.SetMapIndex(key, val)
+	}
+	dst.Set(m)
+	return nil
+}
+
+// isEntries reports whether the type is a slice of structs, or pointers
+// to structs, with key and value fields, which represent a map.
+func isEntries(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return false
+	}
+
+	_, hasKey := elem.FieldByName("Key")
+	_, hasValue := elem.FieldByName("Value")
+	return hasKey && hasValue
+}
+
+func convertMapToEntries(src, dst reflect.Value) error {
+	if src.IsNil() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	var (
+		entries = reflect.MakeSlice(dst.Type(), 0, src.Len())
+		iter    = src.MapRange()
+	)
+	for iter.Next() {
+		entry := reflect.New(dst.Type().Elem()).Elem()
+		e := entry
+		if e.Kind() == reflect.Ptr {
+			e.Set(reflect.New(e.Type().Elem()))
+			e = e.Elem()
+		}
+
+		if err := convert(iter.Key(), e.FieldByName("Key")); err != nil {
+			return fmt.Errorf("key %v: %s", iter.Key().Interface(), err)
+		}
+
+		if err := convert(iter.Value(), e.FieldByName("Value")); err != nil {
+			return fmt.Errorf("[%v]: %s", iter.Key().Interface(), err)
+		}
+		entries = reflect.Append(entries, entry)
+	}
+	dst.Set(entries)
+	return nil
+}
+
+func convertEntriesToMap(src, dst reflect.Value) error {
+	if src.IsNil() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	dt := dst.Type()
+	m := reflect.MakeMapWithSize(dt, src.Len())
+	for i := 0; i < src.Len(); i++ {
+		e := src.Index(i)
+		if e.Kind() == reflect.Ptr {
+			if e.IsNil() {
+				continue
+			}
+			e = e.Elem()
+		}
+
+		key, val := reflect.New(dt.Key()).Elem(), reflect.New(dt.Elem()).Elem()
+		if err := convert(e.FieldByName("Key"), key); err != nil {
+			return fmt.Errorf("[%d].Key: %s", i, err)
+		}
+
+		if err := convert(e.FieldByName("Value"), val); err != nil {
+			return fmt.Errorf("[%d].Value: %s", i, err)
+		}
+		m.SetMapIndex(key, val)
+	}
+	dst.Set(m)
+	return nil
+}
+
+func convertStruct(src, dst reflect.Value) error {
+	srcFields := structFields(src.Type())
+	for name, index := range structFields(dst.Type()) {
+		srcIndex, ok := srcFields[name]
+		if !ok {
+			continue
+		}
+
+		sf, ok := fieldByIndex(src, srcIndex, false)
+		if !ok {
+			continue
+		}
+
+		df, _ := fieldByIndex(dst, index, true)
+		if err := convert(sf, df); err != nil {
+			return fmt.Errorf("%s: %s", dst.Type().FieldByIndex(index).Name, err)
+		}
+	}
+	return nil
+}
+
+var fieldsCache sync.Map
+
+// structFields returns the indexes of the exported fields of the given
+// struct type, including the promoted ones, indexed by their normalized
+// name.
+func structFields(t reflect.Type) map[string][]int {
+	if fields, ok := fieldsCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+
+	var fields = make(map[string][]int)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || (f.Anonymous && indirect(f.Type).Kind() == reflect.Struct) {
+			continue
+		}
+
+		name := normalizeName(f.Name)
+		if prev, ok := fields[name]; ok && len(prev) <= len(f.Index) {
+			continue
+		}
+		fields[name] = f.Index
+	}
+
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+// fieldByIndex returns the field of the given struct with the given index.
+// Nil embedded pointers in the way are allocated if alloc is true, or
+// false is returned otherwise.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
@@ -0,0 +1,189 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Kind int
+
+const (
+	Admin Kind = iota
+	Member
+)
+
+type Base struct {
+	ID uint64
+}
+
+type User struct {
+	Base
+	Name      string
+	Kind      Kind
+	Tags      []string
+	Scores    map[string]int
+	Friends   []*User
+	CreatedAt time.Time
+	Timeout   time.Duration
+	IP        net.IP
+	Groups    map[[2]int]string
+	Settings  struct {
+		Public bool
+	}
+	Ignored string
+}
+
+// pbUser mimics the code generated by protoc for the message of User.
+type pbUser struct {
+	state  int
+	cache  []byte
+	Id     uint64
+	Name   string
+	Kind   int32
+	Tags   []string
+	Scores map[string]int64
+	// Friends are pointers, as all the messages in the generated code.
+	Friends   []*pbUser
+	CreatedAt *timestamppb.Timestamp
+	Timeout   *durationpb.Duration
+	Ip        string
+	Groups    []*pbGroupsEntry
+	Settings  *pbUser_Settings
+}
+
+type pbGroupsEntry struct {
+	Key   []int64
+	Value string
+}
+
+type pbUser_Settings struct {
+	Public bool
+}
+
+func TestConvert(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	user := &User{
+		Base:      Base{ID: 42},
+		Name:      "jane",
+		Kind:      Member,
+		Tags:      []string{"a", "b"},
+		Scores:    map[string]int{"x": 1},
+		Friends:   []*User{{Name: "john"}},
+		CreatedAt: now,
+		Timeout:   time.Second,
+		IP:        net.ParseIP("10.0.0.1"),
+		Groups:    map[[2]int]string{{1, 2}: "g"},
+		Ignored:   "ignored",
+	}
+	user.Settings.Public = true
+
+	var pb *pbUser
+	require.Nil(Convert(user, &pb))
+	require.Equal(uint64(42), pb.Id)
+	require.Equal("jane", pb.Name)
+	require.Equal(int32(1), pb.Kind)
+	require.Equal([]string{"a", "b"}, pb.Tags)
+	require.Equal(map[string]int64{"x": 1}, pb.Scores)
+	require.Equal("john", pb.Friends[0].Name)
+	require.Equal(now, pb.CreatedAt.AsTime())
+	require.Equal(time.Second, pb.Timeout.AsDuration())
+	require.Equal("10.0.0.1", pb.Ip)
+	require.Equal([]*pbGroupsEntry{{Key: []int64{1, 2}, Value: "g"}}, pb.Groups)
+	require.True(pb.Settings.Public)
+
+	var back User
+	require.Nil(Convert(pb, &back))
+	user.Ignored = ""
+	require.Equal(*user, back)
+}
+
+func TestConvertNil(t *testing.T) {
+	require := require.New(t)
+
+	var pb pbUser
+	require.Nil(Convert((*User)(nil), &pb.Settings))
+	require.Nil(pb.Settings)
+
+	var u User
+	require.Nil(Convert(&pb, &u))
+	require.Equal(time.Time{}, u.CreatedAt)
+	require.Nil(u.Tags)
+	require.Nil(u.Scores)
+
+	require.NotNil(Convert(1, nil))
+	require.NotNil(Convert(1, u))
+}
+
+func TestConvertNumbers(t *testing.T) {
+	require := require.New(t)
+
+	var i8 int8
+	require.Nil(Convert(int64(127), &i8))
+	require.Equal(int8(127), i8)
+	require.NotNil(Convert(int64(128), &i8))
+
+	var u uint
+	require.NotNil(Convert(-1, &u))
+	require.Nil(Convert(int32(3), &u))
+	require.Equal(uint(3), u)
+
+	var i int
+	require.Nil(Convert(2.0, &i))
+	require.NotNil(Convert(2.5, &i))
+
+	var f float32
+	require.Nil(Convert(uint64(3), &f))
+	require.Equal(float32(3), f)
+
+	var s string
+	require.NotNil(Convert(1, &s))
+}
+
+type ID struct {
+	n int
+}
+
+func TestRegisterConverter(t *testing.T) {
+	require := require.New(t)
+
+	RegisterConverter(func(id ID) string {
+		return fmt.Sprint(id.n)
+	})
+	RegisterConverter(func(s string) (ID, error) {
+		n, err := strconv.Atoi(s)
+		return ID{n}, err
+	})
+
+	var s string
+	require.Nil(Convert(ID{5}, &s))
+	require.Equal("5", s)
+
+	var ids []ID
+	require.Nil(Convert([]string{"1", "2"}, &ids))
+	require.Equal([]ID{{1}, {2}}, ids)
+	require.NotNil(Convert([]string{"a"}, &ids))
+
+	var other string
+	require.Nil(Convert("foo", &other))
+	require.Equal("foo", other, "converters do not apply to unrelated types")
+
+	RegisterConverter(func(id *ID) int64 {
+		return int64(id.n)
+	})
+	n := int64(1)
+	require.Nil(Convert((*ID)(nil), &n))
+	require.Equal(int64(0), n, "nil values are not passed to converters")
+
+	require.Panics(func() {
+		RegisterConverter(func(a, b int) int { return a })
+	})
+}
@@ -0,0 +1,3 @@
+// Package rpc contains the runtime support of the code generated by
+// proteus to expose Go functions and methods as gRPC services.
+package rpc
@@ -0,0 +1,44 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Status returns the gRPC status of the given error, returned by a
+// function or method exposed as an RPC, or nil if there is no error.
+// Errors that already carry a status, such as the ones created with the
+// status package or implementing `GRPCStatus() *status.Status`, keep it,
+// even if they are wrapped. Context cancellation and deadline errors are
+// mapped to their codes. Any other error has the code codes.Unknown and
+// its message.
+func Status(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return s
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+
+	return status.New(codes.Unknown, err.Error())
+}
+
+// Error returns the given error as a gRPC status error, as described in
+// Status, or nil if there is no error.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return Status(err).Err()
+}
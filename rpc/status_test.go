@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "user not found" }
+
+func (notFoundError) GRPCStatus() *status.Status {
+	return status.New(codes.NotFound, "user not found")
+}
+
+func TestStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		code codes.Code
+		msg  string
+	}{
+		{errors.New("foo"), codes.Unknown, "foo"},
+		{status.Error(codes.InvalidArgument, "bad id"), codes.InvalidArgument, "bad id"},
+		{notFoundError{}, codes.NotFound, "user not found"},
+		{fmt.Errorf("get: %w", notFoundError{}), codes.NotFound, "get: user not found"},
+		{context.Canceled, codes.Canceled, "context canceled"},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), codes.DeadlineExceeded, "get: context deadline exceeded"},
+	}
+
+	for _, c := range cases {
+		s := Status(c.err)
+		require.Equal(t, c.code, s.Code(), c.err.Error())
+		require.Equal(t, c.msg, s.Message(), c.err.Error())
+	}
+
+	require.Nil(t, Status(nil))
+}
+
+func TestError(t *testing.T) {
+	require.Nil(t, Error(nil))
+
+	err := Error(errors.New("foo"))
+	require.Equal(t, codes.Unknown, status.Code(err))
+	require.Equal(t, "rpc error: code = Unknown desc = foo", err.Error())
+}
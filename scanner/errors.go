@@ -0,0 +1,46 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PackageError is the error that happened scanning a single package.
+type PackageError struct {
+	// Path of the package that could not be scanned.
+	Path string
+	// Err is the actual error.
+	Err error
+}
+
+func (e *PackageError) Error() string {
+	return fmt.Sprintf("error scanning package %q: %s", e.Path, e.Err)
+}
+
+func (e *PackageError) Unwrap() error {
+	return e.Err
+}
+
+// ScanError is returned when one or more packages could not be scanned.
+// It contains an error for every package that failed, in the same order
+// in which the packages were given to the Scanner.
+type ScanError struct {
+	Errors []*PackageError
+}
+
+func (e *ScanError) Error() string {
+	var lines = make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Paths returns the paths of all the packages that could not be scanned.
+func (e *ScanError) Paths() []string {
+	var paths = make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		paths[i] = err.Path
+	}
+	return paths
+}
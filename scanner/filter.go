@@ -0,0 +1,192 @@
+package scanner
+
+import (
+	"fmt"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// TypeFilter decides which of the types found in the scanned packages are
+// included in them. A type is included if it matches any of the include
+// patterns, or there are none, and it does not match any of the exclude
+// patterns.
+// A pattern is either a type name (`Foo`), a type name qualified by the
+// path of its package (`github.com/foo/bar.Foo`) or a regular expression
+// enclosed in slashes (`/DTO$/`), which is matched against both the type
+// name and the qualified type name.
+// Include patterns only apply to the types they name: the types of the
+// same package referenced by an included type, or by the functions of the
+// package, are scanned too unless they are excluded, so the included types
+// keep their fields. As packages are scanned independently, referenced
+// types of other packages must be included on their own.
+// Excluded types are not scanned, so no diagnostics are reported about
+// them, except for the types opted in to expose their methods as RPCs.
+type TypeFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewTypeFilter creates a new TypeFilter with the given include and
+// exclude patterns. An error is returned if any of the regular
+// expressions is not valid.
+func NewTypeFilter(include, exclude []string) (*TypeFilter, error) {
+	var (
+		f   = new(TypeFilter)
+		err error
+	)
+
+	if f.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Match reports whether the type with the given name in the package with
+// the given path is included. A nil TypeFilter includes all types.
+func (f *TypeFilter) Match(path, name string) bool {
+	if f == nil {
+		return true
+	}
+
+	qualified := fmt.Sprintf("%s.%s", path, name)
+	return (len(f.include) == 0 || matchAny(f.include, name, qualified)) &&
+		!matchAny(f.exclude, name, qualified)
+}
+
+// excluded reports whether the type with the given name in the package
+// with the given path matches any of the exclude patterns.
+func (f *TypeFilter) excluded(path, name string) bool {
+	return f != nil && matchAny(f.exclude, name, fmt.Sprintf("%s.%s", path, name))
+}
+
+// filterObjects returns the given objects of the package with the given
+// path that are scanned. The types matched by the filter, the types with
+// the given names, which are opted in to expose their methods as RPCs, and
+// the exported functions, if the package is a service, are kept along with
+// all the types of the package they reference that are not excluded.
+// Constants are kept if their type is, as they are the values of enums,
+// and any other object is kept.
+func (f *TypeFilter) filterObjects(path string, objs []types.Object, serviceTypes map[string]bool, service bool) []types.Object {
+	if f == nil {
+		return objs
+	}
+
+	var (
+		kept  = make(map[*types.TypeName]bool)
+		keep  func(*types.TypeName)
+		visit func(types.Type)
+	)
+	keep = func(tn *types.TypeName) {
+		if kept[tn] {
+			return
+		}
+
+		kept[tn] = true
+		visit(tn.Type().Underlying())
+		if serviceTypes[tn.Name()] {
+			ms := types.NewMethodSet(types.NewPointer(tn.Type()))
+			for i := 0; i < ms.Len(); i++ {
+				if ms.At(i).Obj().Exported() {
+					visit(ms.At(i).Type())
+				}
+			}
+		}
+	}
+	visit = func(t types.Type) {
+		switch t := types.Unalias(t).(type) {
+		case *types.Named:
+			obj := t.Obj()
+			if obj.Pkg() != nil && obj.Pkg().Path() == path && !f.excluded(path, obj.Name()) {
+				keep(obj)
+			}
+		case *types.Pointer:
+			visit(t.Elem())
+		case *types.Slice:
+			visit(t.Elem())
+		case *types.Array:
+			visit(t.Elem())
+		case *types.Chan:
+			visit(t.Elem())
+		case *types.Map:
+			visit(t.Key())
+			visit(t.Elem())
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				visit(t.Field(i).Type())
+			}
+		case *types.Signature:
+			for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+				for i := 0; i < tuple.Len(); i++ {
+					visit(tuple.At(i).Type())
+				}
+			}
+		}
+	}
+
+	for _, o := range objs {
+		switch o := o.(type) {
+		case *types.TypeName:
+			if serviceTypes[o.Name()] || f.Match(path, o.Name()) {
+				keep(o)
+			}
+		case *types.Func:
+			if service && o.Exported() {
+				visit(o.Type())
+			}
+		}
+	}
+
+	var result []types.Object
+	for _, o := range objs {
+		switch o := o.(type) {
+		case *types.TypeName:
+			if !kept[o] {
+				continue
+			}
+		case *types.Const:
+			if n, ok := types.Unalias(o.Type()).(*types.Named); ok && n.Obj().Pkg() != nil {
+				typePath := n.Obj().Pkg().Path()
+				if (typePath == path && !kept[n.Obj()]) ||
+					(typePath != path && !f.Match(typePath, n.Obj().Name())) {
+					continue
+				}
+			}
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var result = make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		expr := "^" + regexp.QuoteMeta(p) + "$"
+		if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr = p[1 : len(p)-1]
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type pattern %q: %s", p, err)
+		}
+		result[i] = re
+	}
+	return result, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, names ...string) bool {
+	for _, re := range patterns {
+		for _, n := range names {
+			if re.MatchString(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"fmt"
+	"go/build"
+	"sort"
+	"strings"
+
+	"github.com/src-d/proteus/report"
+)
+
+// followedPaths returns the directories of the packages referenced by the
+// types of the given packages that need to be followed and have not been
+// seen yet. All the import paths of those packages are marked as seen.
+func (s *Scanner) followedPaths(pkgs []*Package, seen map[string]struct{}) []string {
+	if len(s.Follow) == 0 {
+		return nil
+	}
+
+	var (
+		ctx   = s.overlay.buildContext(build.Default)
+		paths []string
+	)
+	for _, path := range referencedPackages(pkgs) {
+		if _, ok := seen[path]; ok || !s.follows(path) {
+			continue
+		}
+		seen[path] = struct{}{}
+
+		pkg, err := ctx.Import(path, "", build.FindOnly)
+		if err != nil {
+			s.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.UnscannedPackage,
+				Message:  fmt.Sprintf("referenced package %s will not be scanned: %s", path, err),
+			})
+			continue
+		}
+
+		paths = append(paths, pkg.Dir)
+	}
+
+	return paths
+}
+
+func (s *Scanner) follows(path string) bool {
+	for _, prefix := range s.Follow {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// referencedPackages returns the import paths of all the packages
+// referenced by the types of the given packages in the order in which
+// they are first referenced.
+func referencedPackages(pkgs []*Package) []string {
+	var (
+		paths []string
+		seen  = make(map[string]struct{})
+		visit func(Type)
+	)
+
+	visit = func(t Type) {
+		switch t := t.(type) {
+		case *Named:
+			if _, ok := seen[t.Path]; !ok {
+				seen[t.Path] = struct{}{}
+				paths = append(paths, t.Path)
+			}
+		case *Map:
+			visit(t.Key)
+			visit(t.Value)
+		}
+	}
+
+	var visitStructs func([]*Struct)
+	visitStructs = func(structs []*Struct) {
+		for _, st := range structs {
+			for _, f := range st.Fields {
+				visit(f.Type)
+			}
+			visitStructs(st.Nested)
+		}
+	}
+
+	for _, p := range pkgs {
+		if p == nil {
+			continue
+		}
+
+		visitStructs(p.Structs)
+		for _, name := range sortedKeys(p.Aliases) {
+			visit(p.Aliases[name])
+		}
+	}
+
+	return paths
+}
+
+func sortedKeys(m map[string]Type) []string {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
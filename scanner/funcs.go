@@ -0,0 +1,412 @@
+package scanner
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/src-d/proteus/report"
+)
+
+// ServiceDirective is the comment directive that opts a package in to
+// have its exported functions exposed as the RPCs of a service. It must
+// be in the doc comment of the package clause of any of its files. It can
+// also be in the doc comment of a type declaration, so the exported
+// methods of the type are exposed as the RPCs of a service of their own.
+const ServiceDirective = "//proteus:service"
+
+// Func is an exported function of a package, or an exported method of a
+// type opted in with ServiceDirective, exposed as an RPC. Its parameters
+// and results are represented as fields, whose name is empty if they are
+// not named. A leading context.Context parameter, a trailing error result
+// and the channels of the streams are not part of them, as they are not
+// part of the messages of the RPC.
+type Func struct {
+	Name    string
+	Params  []*Field
+	Results []*Field
+	// ClientStream is the stream of the values sent by the client or nil
+	// if the RPC has no client stream. The function has no other
+	// parameters if there is one.
+	ClientStream *Stream
+	// ServerStream is the stream of the values sent by the server or nil
+	// if the RPC has no server stream. The function has no other results
+	// if there is one.
+	ServerStream *Stream
+	// Context reports whether the first parameter is a context.Context,
+	// which receives the context of the RPC.
+	Context bool
+	// Error reports whether the last result is an error, which is
+	// returned as the status of the RPC.
+	Error bool
+	// Receiver is the type the method belongs to or nil if it is a
+	// function.
+	Receiver *Receiver
+	// Signature is the Go signature of the function, including the
+	// context, the error and the channels, which is needed to declare
+	// values of the exact types of its parameters and results.
+	Signature *types.Signature
+	// Pos is the position of the declaration of the function.
+	Pos token.Position
+}
+
+// FullName returns the name of the function, qualified with the name of
+// its receiver if it is a method, such as `UserStore.Get`.
+func (f *Func) FullName() string {
+	if f.Receiver == nil {
+		return f.Name
+	}
+	return fmt.Sprintf("%s.%s", f.Receiver.Name, f.Name)
+}
+
+// Fields returns all the parameters and results of the function,
+// including the ones of the streams.
+func (f *Func) Fields() []*Field {
+	var fields []*Field
+	fields = append(fields, f.Params...)
+	fields = append(fields, f.Results...)
+	for _, s := range []*Stream{f.ClientStream, f.ServerStream} {
+		if s != nil {
+			fields = append(fields, s.Field)
+		}
+	}
+	return fields
+}
+
+// Stream is a channel parameter or result of a function, whose values are
+// streamed. A `<-chan T` parameter is a client stream, as the function
+// receives from it, while a `chan<- T` parameter or a `<-chan T` result
+// are server streams, as the function sends to them.
+type Stream struct {
+	// Field is the parameter or result of the channel, whose type is the
+	// type of the streamed values.
+	Field *Field
+	// Result reports whether the channel is a result of the function
+	// instead of a parameter.
+	Result bool
+	// Index is the position of the channel among the parameters or
+	// results of the function, not counting a leading context.Context or
+	// a trailing error. The rest of parameters or results come in order
+	// around it.
+	Index int
+}
+
+// Receiver is a type whose exported methods are exposed as the RPCs of a
+// service. A value of the type is bound when the service is constructed
+// and all the RPCs are called on it.
+type Receiver struct {
+	Name string
+	// Pointer reports whether the bound value is a pointer to the type,
+	// which is required if any of the methods has a pointer receiver.
+	// Methods of interfaces are always called on the interface value.
+	Pointer bool
+	// Pos is the position of the declaration of the type.
+	Pos token.Position
+}
+
+// hasDirective reports whether any of the given comments contains the
+// given directive.
+func hasDirective(directive string, comments ...*ast.CommentGroup) bool {
+	for _, cg := range comments {
+		if cg == nil {
+			continue
+		}
+
+		for _, c := range cg.List {
+			text := strings.TrimSpace(c.Text)
+			if text == directive || strings.HasPrefix(text, directive+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isService reports whether the package of the given files is opted in
+// to have its functions exposed as RPCs.
+func isService(files []*ast.File) bool {
+	for _, f := range files {
+		if hasDirective(ServiceDirective, f.Doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceTypes returns the names of the types declared in the given files
+// that are opted in to have their methods exposed as RPCs.
+func serviceTypes(files []*ast.File) map[string]bool {
+	var names = make(map[string]bool)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if len(gd.Specs) == 1 && doc == nil {
+					doc = gd.Doc
+				}
+
+				if hasDirective(ServiceDirective, doc) {
+					names[ts.Name.Name] = true
+				}
+			}
+		}
+	}
+	return names
+}
+
+// processMethods adds as funcs all the exported methods of the given type,
+// which is opted in to be a service.
+func (p *Package) processMethods(n *types.Named) {
+	obj := n.Obj()
+	recv := &Receiver{Name: obj.Name(), Pos: p.position(obj.Pos())}
+	if n.TypeParams().Len() > 0 {
+		p.report(&report.Diagnostic{
+			Severity: report.Warning,
+			Code:     report.InvalidRPC,
+			Message:  fmt.Sprintf("type %s will not be a service because it is generic", recv.Name),
+			Pos:      recv.Pos,
+			Type:     objName(obj),
+		})
+		return
+	}
+
+	var mset *types.MethodSet
+	if types.IsInterface(n) {
+		mset = types.NewMethodSet(n)
+	} else {
+		mset = types.NewMethodSet(types.NewPointer(n))
+	}
+
+	for i := 0; i < mset.Len(); i++ {
+		f := mset.At(i).Obj().(*types.Func)
+		if !f.Exported() {
+			continue
+		}
+
+		if !types.IsInterface(n) {
+			if _, ok := f.Type().(*types.Signature).Recv().Type().(*types.Pointer); ok {
+				recv.Pointer = true
+			}
+		}
+		p.processFunc(f, recv)
+	}
+}
+
+// processFunc adds the given function, which is a method of the given
+// receiver unless it is nil, as a func if it can be exposed as an RPC.
+func (p *Package) processFunc(f *types.Func, recv *Receiver) {
+	sig := f.Type().(*types.Signature)
+	if recv == nil && sig.Recv() != nil {
+		return
+	}
+
+	fn := &Func{Name: f.Name(), Receiver: recv, Signature: sig, Pos: p.position(f.Pos())}
+	name := fmt.Sprintf("%s.%s", p.Path, fn.FullName())
+
+	switch {
+	case sig.TypeParams().Len() > 0:
+		p.invalidRPC(fn, name, "it is generic")
+		return
+	case sig.Variadic():
+		p.invalidRPC(fn, name, "it is variadic")
+		return
+	}
+
+	var (
+		params, results = tupleVars(sig.Params()), tupleVars(sig.Results())
+		offset          int
+	)
+	if len(params) > 0 && isContext(params[0].Type()) {
+		fn.Context = true
+		params = params[1:]
+		offset = 1
+	}
+
+	if n := len(results); n > 0 && isError(results[n-1].Type()) {
+		fn.Error = true
+		results = results[:n-1]
+	}
+
+	var ok bool
+	if fn.Params, ok = p.processTuple(fn, name, params, offset, false); !ok {
+		return
+	}
+
+	if fn.Results, ok = p.processTuple(fn, name, results, 0, true); !ok {
+		return
+	}
+
+	switch {
+	case fn.ClientStream != nil && len(fn.Params) > 0:
+		p.invalidRPC(fn, name, "it has other parameters besides the client stream")
+		return
+	case fn.ServerStream != nil && len(fn.Results) > 0:
+		p.invalidRPC(fn, name, "it has other results besides the server stream")
+		return
+	}
+
+	p.Funcs = append(p.Funcs, fn)
+}
+
+func tupleVars(tuple *types.Tuple) []*types.Var {
+	var vars = make([]*types.Var, tuple.Len())
+	for i := range vars {
+		vars[i] = tuple.At(i)
+	}
+	return vars
+}
+
+// isContext reports whether the given type is context.Context.
+func isContext(typ types.Type) bool {
+	n, ok := types.Unalias(typ).(*types.Named)
+	return ok && n.Obj().Pkg() != nil &&
+		n.Obj().Pkg().Path() == "context" &&
+		n.Obj().Name() == "Context"
+}
+
+// isError reports whether the given type is the error interface.
+func isError(typ types.Type) bool {
+	return types.Identical(typ, types.Universe.Lookup("error").Type())
+}
+
+// processTuple returns the fields representing the given parameters or
+// results of the given function, the first of them at the given offset of
+// the signature, or false if any of them can not be represented. Channels
+// are set as the streams of the function instead.
+func (p *Package) processTuple(fn *Func, name string, vars []*types.Var, offset int, results bool) ([]*Field, bool) {
+	var (
+		fields []*Field
+		kind   = "parameter"
+	)
+	if results {
+		kind = "result"
+	}
+
+	for i, v := range vars {
+		if ch, ok := types.Unalias(v.Type()).(*types.Chan); ok {
+			if !p.processStream(fn, name, v, ch, i, results, fmt.Sprintf("its %s %s", kind, tupleVarName(v, offset+i))) {
+				return nil, false
+			}
+			continue
+		}
+
+		switch {
+		case isContext(v.Type()):
+			p.invalidRPC(fn, name, fmt.Sprintf("its %s %s is a context.Context, which can only be the first parameter", kind, tupleVarName(v, offset+i)))
+			return nil, false
+		case isError(v.Type()):
+			p.invalidRPC(fn, name, fmt.Sprintf("its %s %s is an error, which can only be the last result", kind, tupleVarName(v, offset+i)))
+			return nil, false
+		}
+
+		pos := p.position(v.Pos())
+		typ := p.processType(v.Type(), location{pos, name})
+		if typ == nil {
+			p.invalidRPC(fn, name, fmt.Sprintf("its %s %s has an unsupported type", kind, tupleVarName(v, offset+i)))
+			return nil, false
+		}
+
+		fields = append(fields, &Field{Name: paramFieldName(v), Type: typ, Pos: pos})
+	}
+	return fields, true
+}
+
+// processStream sets the given channel, which is the parameter or result
+// at the given index, as a stream of the given function. It returns false
+// if the channel can not be streamed. The subject describes the channel in
+// the reported diagnostics.
+//
+// The stream follows the direction the values flow in: a `<-chan T`
+// parameter is received by the function, so it is a client stream, while
+// a `chan<- T` parameter and a `<-chan T` result are sent by it, so they
+// are server streams. Making `chan<- T` parameters client streams would
+// give the function a channel it can only send to, but never receive the
+// streamed values from.
+func (p *Package) processStream(fn *Func, name string, v *types.Var, ch *types.Chan, index int, result bool, subject string) bool {
+	switch {
+	case ch.Dir() == types.SendRecv:
+		p.invalidRPC(fn, name, subject+" is a bidirectional channel, whose direction can not be streamed")
+		return false
+	case result && ch.Dir() == types.SendOnly:
+		p.invalidRPC(fn, name, subject+" is a send-only channel, which can not be streamed")
+		return false
+	}
+
+	target, kind := &fn.ServerStream, "server"
+	if !result && ch.Dir() == types.RecvOnly {
+		target, kind = &fn.ClientStream, "client"
+	}
+
+	if *target != nil {
+		p.invalidRPC(fn, name, fmt.Sprintf("it has more than one %s stream", kind))
+		return false
+	}
+
+	pos := p.position(v.Pos())
+	typ := p.processType(ch.Elem(), location{pos, name})
+	if typ == nil {
+		p.invalidRPC(fn, name, subject+" is a channel of an unsupported type")
+		return false
+	}
+
+	*target = &Stream{
+		Field:  &Field{Name: paramFieldName(v), Type: typ, Pos: pos},
+		Result: result,
+		Index:  index,
+	}
+	return true
+}
+
+// paramFieldName returns the name of the field of the given parameter or
+// result, which is empty if it has no name or is blank.
+func paramFieldName(v *types.Var) string {
+	if v.Name() == "_" {
+		return ""
+	}
+	return v.Name()
+}
+
+func tupleVarName(v *types.Var, i int) string {
+	if v.Name() == "" || v.Name() == "_" {
+		return fmt.Sprintf("#%d", i+1)
+	}
+	return fmt.Sprintf("%q", v.Name())
+}
+
+func (p *Package) invalidRPC(fn *Func, name, reason string) {
+	p.report(&report.Diagnostic{
+		Severity: report.Warning,
+		Code:     report.InvalidRPC,
+		Message:  fmt.Sprintf("function %s will not be an RPC because %s", fn.FullName(), reason),
+		Pos:      fn.Pos,
+		Type:     name,
+	})
+}
+
+func mergeFuncs(a, b []*Func) []*Func {
+	for _, f := range b {
+		if funcByName(a, f.FullName()) == nil {
+			a = append(a, f)
+		}
+	}
+	return a
+}
+
+// funcByName returns the func with the given full name or nil if there is
+// none.
+func funcByName(funcs []*Func, name string) *Func {
+	for _, f := range funcs {
+		if f.FullName() == name {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// loader loads and type-checks from source all the packages of a single
+// scan. All of them share the same file set and importer, so a package
+// imported by other scanned packages is only type-checked once and all
+// of them share the same types.Object values, instead of using the
+// compiled archives of the scanned packages.
+// Packages that are not being scanned but are followed are added to the
+// loader on demand when they are imported.
+type loader struct {
+	ctx     context.Context
+	build   build.Context
+	overlay overlay
+	fset    *token.FileSet
+	follow  func(path string) bool
+
+	mut sync.Mutex
+	// dirs contains the directories of the loaded packages indexed by
+	// their import path.
+	dirs map[string]string
+	// pkgs contains all the loaded packages indexed by directory.
+	pkgs map[string]*loadedPackage
+
+	// fallback imports the packages that are not loaded from their
+	// compiled archives. It is not safe for concurrent use.
+	fallback    types.Importer
+	fallbackMut sync.Mutex
+}
+
+type loadedPackage struct {
+	once    sync.Once
+	started bool
+	path    string
+	files   []string
+	imports []string
+	pkg     *types.Package
+	syntax  []*ast.File
+	err     error
+}
+
+func newLoader(ctx context.Context, bctx build.Context, o overlay, follow func(string) bool) *loader {
+	fset := token.NewFileSet()
+	return &loader{
+		ctx:      ctx,
+		build:    bctx,
+		overlay:  o,
+		fset:     fset,
+		follow:   follow,
+		dirs:     make(map[string]string),
+		pkgs:     make(map[string]*loadedPackage),
+		fallback: importer.ForCompiler(fset, "gc", nil),
+	}
+}
+
+// add adds the packages in the given directories to the loader, if they
+// were not already added.
+func (l *loader) add(dirs ...string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if _, ok := l.pkgs[dir]; ok {
+			continue
+		}
+
+		p := new(loadedPackage)
+		l.pkgs[dir] = p
+
+		var bpkg *build.Package
+		bpkg, p.files, p.err = getSourceFiles(l.build, dir)
+		if p.err != nil {
+			continue
+		}
+
+		p.path = l.importPath(bpkg, dir)
+		p.imports = bpkg.Imports
+		l.dirs[p.path] = dir
+	}
+
+	l.checkCycles()
+}
+
+// importPath returns the import path of the package in the given
+// directory. If it is not in any GOPATH, the import path is guessed from
+// the closest go.mod file. If that is not possible either, the directory
+// itself is used as import path.
+func (l *loader) importPath(bpkg *build.Package, dir string) string {
+	if bpkg.ImportPath != "" && bpkg.ImportPath != "." {
+		return bpkg.ImportPath
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	for root := abs; ; root = filepath.Dir(root) {
+		if mod := l.modulePath(filepath.Join(root, "go.mod")); mod != "" {
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return dir
+			}
+			return path.Join(mod, filepath.ToSlash(rel))
+		}
+
+		if filepath.Dir(root) == root {
+			return dir
+		}
+	}
+}
+
+// modulePath returns the module path declared in the given go.mod file
+// or an empty string if the file does not exist or has no module path.
+func (l *loader) modulePath(gomod string) string {
+	f, err := l.overlay.openFile(gomod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`")
+		}
+	}
+	return ""
+}
+
+// checkCycles marks with an error all the loaded packages that are part
+// of an import cycle between loaded packages and have not started being
+// loaded, as type-checking them would never finish. It must be called
+// with the mutex held.
+func (l *loader) checkCycles() {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	var (
+		state = make(map[string]int)
+		stack []string
+		visit func(dir string)
+	)
+
+	visit = func(dir string) {
+		state[dir] = visiting
+		stack = append(stack, dir)
+		for _, imp := range l.pkgs[dir].imports {
+			dep, ok := l.dirs[imp]
+			if !ok {
+				continue
+			}
+
+			switch state[dep] {
+			case visiting:
+				l.markCycle(stack, dep)
+			case 0:
+				visit(dep)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[dir] = visited
+	}
+
+	for dir := range l.pkgs {
+		if state[dir] == 0 {
+			visit(dir)
+		}
+	}
+}
+
+func (l *loader) markCycle(stack []string, dep string) {
+	var start int
+	for i, dir := range stack {
+		if dir == dep {
+			start = i
+			break
+		}
+	}
+
+	var cycle []string
+	for _, dir := range stack[start:] {
+		cycle = append(cycle, l.pkgs[dir].path)
+	}
+	cycle = append(cycle, l.pkgs[dep].path)
+
+	err := fmt.Errorf("import cycle not allowed: %s", strings.Join(cycle, " -> "))
+	for _, dir := range stack[start:] {
+		if p := l.pkgs[dir]; !p.started && p.err == nil {
+			p.err = err
+		}
+	}
+}
+
+// load returns the type-checked package in the given directory, which
+// must have been added to the loader.
+func (l *loader) load(dir string) (*loadedPackage, error) {
+	l.mut.Lock()
+	p, ok := l.pkgs[filepath.Clean(dir)]
+	l.mut.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("package in %s is not being scanned", dir)
+	}
+
+	p.once.Do(func() {
+		l.mut.Lock()
+		p.started = true
+		err := p.err
+		l.mut.Unlock()
+		if err != nil {
+			return
+		}
+
+		p.syntax, p.err = parseSourceFiles(l.ctx, l.fset, p.files, l.overlay)
+		if p.err != nil {
+			return
+		}
+
+		config := types.Config{Importer: l}
+		p.pkg, p.err = config.Check(p.path, l.fset, p.syntax, new(types.Info))
+	})
+
+	return p, p.err
+}
+
+// Import implements the types.Importer interface.
+func (l *loader) Import(path string) (*types.Package, error) {
+	return l.ImportFrom(path, "", 0)
+}
+
+// ImportFrom implements the types.ImporterFrom interface. Packages that
+// are loaded or followed are type-checked from source, the rest are
+// imported from their compiled archives.
+func (l *loader) ImportFrom(path, srcDir string, _ types.ImportMode) (*types.Package, error) {
+	l.mut.Lock()
+	dir, ok := l.dirs[path]
+	l.mut.Unlock()
+
+	if !ok && l.follow != nil && l.follow(path) {
+		if bpkg, err := l.build.Import(path, srcDir, build.FindOnly); err == nil {
+			l.add(bpkg.Dir)
+			dir, ok = bpkg.Dir, true
+		}
+	}
+
+	if ok {
+		p, err := l.load(dir)
+		if err != nil {
+			return nil, err
+		}
+		return p.pkg, nil
+	}
+
+	l.fallbackMut.Lock()
+	defer l.fallbackMut.Unlock()
+	return l.fallback.Import(path)
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"go/token"
+	"go/types"
+)
+
+// Marshaler is a kind of marshaling interfaces of the encoding package
+// that a type can implement to be converted to and from a basic type.
+type Marshaler int
+
+const (
+	// NoMarshaler is the kind of the types that do not implement any
+	// marshaling interface.
+	NoMarshaler Marshaler = iota
+	// TextMarshaler is the kind of the types that implement both
+	// encoding.TextMarshaler and encoding.TextUnmarshaler.
+	TextMarshaler
+	// BinaryMarshaler is the kind of the types that implement both
+	// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+	BinaryMarshaler
+)
+
+var (
+	textMarshaler   = newMarshalerInterface("MarshalText", "UnmarshalText")
+	binaryMarshaler = newMarshalerInterface("MarshalBinary", "UnmarshalBinary")
+)
+
+// findMarshaler returns the kind of marshaling interfaces implemented by
+// the given named type or a pointer to it. If it implements both,
+// TextMarshaler is preferred.
+func findMarshaler(n *types.Named) Marshaler {
+	ptr := types.NewPointer(n)
+	switch {
+	case types.Implements(ptr, textMarshaler):
+		return TextMarshaler
+	case types.Implements(ptr, binaryMarshaler):
+		return BinaryMarshaler
+	default:
+		return NoMarshaler
+	}
+}
+
+// newMarshalerInterface returns an interface with the two given methods,
+// with the signatures of the Marshal and Unmarshal methods of the
+// interfaces in the encoding package:
+//
+//	Marshal() ([]byte, error)
+//	Unmarshal([]byte) error
+func newMarshalerInterface(marshal, unmarshal string) *types.Interface {
+	var (
+		bytes = types.NewSlice(types.Typ[types.Byte])
+		err   = types.Universe.Lookup("error").Type()
+	)
+
+	methods := []*types.Func{
+		types.NewFunc(token.NoPos, nil, marshal, types.NewSignatureType(
+			nil, nil, nil,
+			nil,
+			types.NewTuple(newVar(bytes), newVar(err)),
+			false,
+		)),
+		types.NewFunc(token.NoPos, nil, unmarshal, types.NewSignatureType(
+			nil, nil, nil,
+			types.NewTuple(newVar(bytes)),
+			types.NewTuple(newVar(err)),
+			false,
+		)),
+	}
+
+	return types.NewInterfaceType(methods, nil).Complete()
+}
+
+func newVar(typ types.Type) *types.Var {
+	return types.NewVar(token.NoPos, nil, "", typ)
+}
@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"bytes"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// overlay is a set of file contents, indexed by their absolute path, that
+// replace the contents of the files on disk or add new files that are not
+// on disk at all. A nil overlay just reads everything from disk.
+type overlay map[string][]byte
+
+func newOverlay(files map[string][]byte) overlay {
+	o := make(overlay, len(files))
+	for path, content := range files {
+		o[absPath(path)] = content
+	}
+	return o
+}
+
+// absPath returns the absolute form of the given path, which is only
+// cleaned if it can not be made absolute.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// isDir reports whether the given path is a directory, either because it
+// exists on disk or because there are files in it or in any of its
+// subdirectories in the overlay.
+func (o overlay) isDir(path string) bool {
+	path = absPath(path)
+	for f := range o {
+		for dir := filepath.Dir(f); ; dir = filepath.Dir(dir) {
+			if dir == path {
+				return true
+			}
+
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// readDir returns the files in the given directory, with the ones in the
+// overlay taking precedence over the ones on disk.
+func (o overlay) readDir(dir string) ([]os.FileInfo, error) {
+	dir = absPath(dir)
+	files := make(map[string]os.FileInfo)
+	for f, content := range o {
+		if filepath.Dir(f) == dir {
+			files[filepath.Base(f)] = &overlayFileInfo{filepath.Base(f), int64(len(content))}
+		}
+	}
+
+	onDisk, err := ioutil.ReadDir(dir)
+	if err != nil && (len(files) == 0 || !os.IsNotExist(err)) {
+		return nil, err
+	}
+
+	for _, fi := range onDisk {
+		if _, ok := files[fi.Name()]; !ok {
+			files[fi.Name()] = fi
+		}
+	}
+
+	var result = make([]os.FileInfo, 0, len(files))
+	for _, fi := range files {
+		result = append(result, fi)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+func (o overlay) openFile(path string) (io.ReadCloser, error) {
+	if content, ok := o[absPath(path)]; ok {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+	return os.Open(path)
+}
+
+// source returns the source of the given file to be passed to the parser,
+// which is nil if the file is not in the overlay and has to be read from
+// disk.
+func (o overlay) source(path string) interface{} {
+	if content, ok := o[absPath(path)]; ok {
+		return content
+	}
+	return nil
+}
+
+// buildContext returns a copy of the given build context that reads
+// files and directories through the overlay.
+func (o overlay) buildContext(ctx build.Context) build.Context {
+	if o == nil {
+		return ctx
+	}
+
+	ctx.IsDir = o.isDir
+	ctx.ReadDir = o.readDir
+	ctx.OpenFile = o.openFile
+	return ctx
+}
+
+// overlayFileInfo is the os.FileInfo of a file in the overlay.
+type overlayFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi *overlayFileInfo) Name() string       { return fi.name }
+func (fi *overlayFileInfo) Size() int64        { return fi.size }
+func (fi *overlayFileInfo) Mode() os.FileMode  { return 0444 }
+func (fi *overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *overlayFileInfo) IsDir() bool        { return false }
+func (fi *overlayFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"fmt"
+	"go/build"
+	"strings"
+)
+
+// Platform is a build configuration used to select which source files of
+// the scanned packages are taken into account, according to their build
+// constraints. Empty values default to the ones of the running machine.
+type Platform struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+func (p Platform) String() string {
+	ctx := p.buildContext()
+	s := fmt.Sprintf("%s/%s", ctx.GOOS, ctx.GOARCH)
+	if len(p.Tags) > 0 {
+		s += fmt.Sprintf(" (tags: %s)", strings.Join(p.Tags, ","))
+	}
+	return s
+}
+
+func (p Platform) buildContext() build.Context {
+	ctx := build.Default
+	if p.GOOS != "" {
+		ctx.GOOS = p.GOOS
+	}
+
+	if p.GOARCH != "" {
+		ctx.GOARCH = p.GOARCH
+	}
+
+	// As the go tool does, cgo is disabled by default when the target
+	// platform is not the one of the running machine.
+	if ctx.GOOS != build.Default.GOOS || ctx.GOARCH != build.Default.GOARCH {
+		ctx.CgoEnabled = false
+	}
+
+	ctx.BuildTags = p.Tags
+	return ctx
+}
+
+// mergePackages merges the package b, which is the same package as a
+// scanned for a different platform, into a. Structs, enums, aliases and
+// funcs only present in b are added to a, as well as the fields and enum
+// values only present in b.
+func mergePackages(a, b *Package) *Package {
+	a.Structs = mergeStructs(a.Structs, b.Structs)
+
+	for _, e := range b.Enums {
+		if ea := enumByName(a.Enums, e.Name); ea != nil {
+			ea.Values = mergeValues(ea.Values, e.Values)
+			for v, n := range e.Numbers {
+				if _, ok := ea.Numbers[v]; !ok {
+					if ea.Numbers == nil {
+						ea.Numbers = make(map[string]int64)
+					}
+					ea.Numbers[v] = n
+				}
+			}
+		} else {
+			a.Enums = append(a.Enums, e)
+		}
+	}
+
+	for k, t := range b.Aliases {
+		if _, ok := a.Aliases[k]; !ok {
+			a.Aliases[k] = t
+		}
+	}
+
+	a.Funcs = mergeFuncs(a.Funcs, b.Funcs)
+
+	return a
+}
+
+func mergeStructs(a, b []*Struct) []*Struct {
+	for _, s := range b {
+		sa := structByName(a, s.Name)
+		if sa == nil {
+			a = append(a, s)
+			continue
+		}
+
+		for _, f := range s.Fields {
+			if !sa.HasField(f.Name) {
+				sa.Fields = append(sa.Fields, f)
+			}
+		}
+		sa.Nested = mergeStructs(sa.Nested, s.Nested)
+	}
+	return a
+}
+
+func mergeValues(a, b []string) []string {
+	for _, v := range b {
+		var found bool
+		for _, va := range a {
+			if va == v {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+func structByName(structs []*Struct, name string) *Struct {
+	for _, s := range structs {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func enumByName(enums []*Enum, name string) *Enum {
+	for _, e := range enums {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
@@ -1,15 +1,18 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/build"
-	"go/importer"
+	"go/constant"
 	"go/parser"
 	"go/token"
 	"go/types"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 
@@ -18,6 +21,12 @@ import (
 
 // Package holds information about a single Go package and
 // a reference of all defined structs and type aliases.
+// Aliases are defined types whose underlying type is not a struct, such
+// as `type IntList []int`. Alias declarations (`type A = B`) are not
+// recorded anywhere, as they are always resolved to their target.
+// Funcs are only scanned in packages opted in with ServiceDirective, and
+// methods only for the types opted in with it, which are not recorded as
+// structs or aliases.
 // A Package is only safe to use once it is resolved.
 type Package struct {
 	Resolved bool
@@ -26,7 +35,20 @@ type Package struct {
 	Structs  []*Struct
 	Enums    []*Enum
 	Aliases  map[string]Type
+	Funcs    []*Func
 	values   map[string][]string
+	// numbers contains the values of the enum constants, indexed by name.
+	numbers map[string]int64
+	// nonEnums contains the types with constants that do not make an
+	// enum, which are only reported once.
+	nonEnums map[string]bool
+
+	fset     *token.FileSet
+	reporter report.Reporter
+	service  bool
+	// serviceTypes are the names of the types opted in to have their
+	// methods exposed as RPCs.
+	serviceTypes map[string]bool
 }
 
 // Type is the common interface for all possible types supported in protogo.
@@ -39,6 +61,8 @@ type Type interface {
 	SetNullable(bool)
 	IsRepeated() bool
 	IsNullable() bool
+	// Clone returns a deep copy of the type.
+	Clone() Type
 }
 
 // BaseType contains the common fields for all the types.
@@ -59,6 +83,14 @@ func (t *BaseType) IsNullable() bool   { return t.Nullable }
 func (t *BaseType) SetRepeated(v bool) { t.Repeated = v }
 func (t *BaseType) SetNullable(v bool) { t.Nullable = v }
 
+func (t *BaseType) clone() *BaseType {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
 // Basic is a basic type, which only is identified by its name.
 type Basic struct {
 	*BaseType
@@ -72,11 +104,19 @@ func NewBasic(name string) Type {
 	}
 }
 
+func (b *Basic) Clone() Type {
+	return &Basic{b.BaseType.clone(), b.Name}
+}
+
 // Named is non-basic type identified by a name on some package.
 type Named struct {
 	*BaseType
 	Path string
 	Name string
+	// Marshaler is the kind of marshaling interfaces implemented by the
+	// type, which allows representing it even if its package is not
+	// scanned.
+	Marshaler Marshaler
 }
 
 func (n Named) String() string {
@@ -88,9 +128,14 @@ func NewNamed(path, name string) Type {
 		newBaseType(),
 		path,
 		name,
+		NoMarshaler,
 	}
 }
 
+func (n *Named) Clone() Type {
+	return &Named{n.BaseType.clone(), n.Path, n.Name, n.Marshaler}
+}
+
 // Map is a map type with a key and a value type.
 type Map struct {
 	*BaseType
@@ -106,16 +151,36 @@ func NewMap(key, val Type) Type {
 	}
 }
 
-// Enum consists of a list of possible values.
+func (m *Map) Clone() Type {
+	return &Map{m.BaseType.clone(), cloneType(m.Key), cloneType(m.Value)}
+}
+
+func cloneType(t Type) Type {
+	if t == nil {
+		return nil
+	}
+	return t.Clone()
+}
+
+// Enum consists of a list of possible values, which are the integer
+// constants of a named type.
 type Enum struct {
 	Name   string
 	Values []string
+	// Numbers contains the values of the constants, indexed by name.
+	Numbers map[string]int64
 }
 
 // Struct represents a Go struct with its name and fields.
+// Fields whose type is an anonymous struct are represented as structs
+// nested in their parent, named after the parent struct and the field,
+// e.g. `Foo.Config` for the field `Config` of the struct `Foo`.
 type Struct struct {
 	Name   string
 	Fields []*Field
+	Nested []*Struct
+	// Pos is the position of the declaration of the struct.
+	Pos token.Position
 }
 
 func (s *Struct) HasField(name string) bool {
@@ -131,12 +196,43 @@ func (s *Struct) HasField(name string) bool {
 type Field struct {
 	Name string
 	Type Type
+	// Number is the number of the field given with a `proto:"<number>"`
+	// tag, or zero if it has none.
+	Number int
+	// Pos is the position of the declaration of the field.
+	Pos token.Position
 }
 
 // Scanner scans paths looking for Go source files to parse
 // and extract types and structs from.
 type Scanner struct {
-	paths []string
+	// Workers is the maximum number of packages that will be scanned
+	// concurrently. If it is zero or negative, the number of CPUs
+	// available is used.
+	Workers int
+	// Platforms are the build configurations used to select the source
+	// files of the scanned packages. If there is more than one, packages
+	// are scanned once per platform and the results are merged, so types
+	// and fields only available on some platforms are included. If it is
+	// empty, the build configuration of the running machine is used.
+	Platforms []Platform
+	// Filter decides which structs and enums of the scanned packages are
+	// included. If it is nil, all of them are.
+	Filter *TypeFilter
+	// Follow contains import path prefixes, usually module paths, of the
+	// packages that will be scanned on demand if they are referenced by
+	// the types of the scanned packages, even if they were not given to
+	// the Scanner. Referenced packages of the followed packages are also
+	// scanned, so all the reachable types are included.
+	Follow []string
+	// Reporter receives the diagnostics found while scanning. If it is
+	// nil, report.Default is used. If it is a report.Suppressor, the
+	// ignore directives of the scanned packages are registered in it
+	// before building them.
+	Reporter report.Reporter
+
+	paths   []string
+	overlay overlay
 }
 
 // New creates a new Scanner that will look for types and structs
@@ -155,117 +251,379 @@ func New(paths ...string) (*Scanner, error) {
 	return &Scanner{paths: paths}, nil
 }
 
+// NewWithOverlay creates a new Scanner that will look for types and
+// structs only in the given paths, reading files from the given overlay
+// before reading them from disk. The overlay maps file paths to their
+// contents and can replace files on disk or add new ones, even in
+// directories that do not exist on disk at all.
+func NewWithOverlay(overlay map[string][]byte, paths ...string) (*Scanner, error) {
+	o := newOverlay(overlay)
+	for _, p := range paths {
+		if !o.isDir(p) {
+			return nil, fmt.Errorf("path is not directory: %s", p)
+		}
+	}
+
+	return &Scanner{paths: paths, overlay: o}, nil
+}
+
 // Scan retrieves the scanned packages containing the extracted
 // go types and structs.
 func (s *Scanner) Scan() ([]*Package, error) {
+	return s.ScanContext(context.Background())
+}
+
+// ScanContext retrieves the scanned packages containing the extracted
+// go types and structs. At most `Workers` packages are scanned at the
+// same time. If the context is cancelled, scanning stops as soon as
+// possible and the context error is returned.
+// If some packages can not be scanned, the packages that could be scanned
+// are returned along with a *ScanError describing the ones that failed.
+func (s *Scanner) ScanContext(ctx context.Context) ([]*Package, error) {
+	platforms := s.Platforms
+	if len(platforms) == 0 {
+		platforms = []Platform{{}}
+	}
+
+	var loaders = make([]*loader, len(platforms))
+	for i, p := range platforms {
+		loaders[i] = newLoader(ctx, s.overlay.buildContext(p.buildContext()), s.overlay, s.follows)
+	}
+
 	var (
-		pkgs   = make([]*Package, len(s.paths))
-		errors []error
-		mut    sync.Mutex
-		wg     = new(sync.WaitGroup)
+		result  []*Package
+		scanErr = new(ScanError)
+		seen    = make(map[string]struct{})
+		paths   = s.paths
 	)
 
-	wg.Add(len(s.paths))
-	for i, p := range s.paths {
-		go func(p string, i int) {
-			defer wg.Done()
+	for len(paths) > 0 {
+		pkgs, errs := s.scanPaths(ctx, platforms, loaders, paths)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-			pkg, err := s.scanPackage(p)
-			mut.Lock()
-			defer mut.Unlock()
+		for i, err := range errs {
 			if err != nil {
-				errors = append(errors, fmt.Errorf("error scanning package %q: %s", p, err))
+				scanErr.Errors = append(scanErr.Errors, &PackageError{paths[i], err})
 			} else {
-				pkgs[i] = pkg
+				result = append(result, pkgs[i])
+				seen[pkgs[i].Path] = struct{}{}
 			}
-		}(p, i)
+		}
+
+		paths = s.followedPaths(pkgs, seen)
 	}
 
-	wg.Wait()
-	if len(errors) > 0 {
-		var lines []string
-		for _, err := range errors {
-			lines = append(lines, err.Error())
+	if len(scanErr.Errors) > 0 {
+		return result, scanErr
+	}
+
+	return result, nil
+}
+
+// scanPaths scans the packages in the given paths for all platforms, each
+// one with its own loader, and returns the packages and errors found for
+// every path in the same position as their path. The packages scanned for
+// several platforms are merged. A package only fails if it fails for every
+// platform, as it may have no source files for some of them, otherwise the
+// platforms it fails for are reported as warnings.
+func (s *Scanner) scanPaths(ctx context.Context, platforms []Platform, loaders []*loader, paths []string) ([]*Package, []error) {
+	var (
+		pkgs     = make([]*Package, len(paths))
+		errs     = make([]error, len(paths))
+		failures = make([][]string, len(paths))
+	)
+	for i, p := range platforms {
+		ppkgs, perrs := s.scanPlatform(ctx, loaders[i], paths)
+		if ctx.Err() != nil {
+			break
+		}
+
+		for j := range paths {
+			switch {
+			case perrs[j] != nil && len(platforms) > 1:
+				failures[j] = append(failures[j], fmt.Sprintf("%s: %s", p, perrs[j]))
+			case perrs[j] != nil:
+				errs[j] = perrs[j]
+			case pkgs[j] == nil:
+				pkgs[j] = ppkgs[j]
+			default:
+				pkgs[j] = mergePackages(pkgs[j], ppkgs[j])
+			}
+		}
+	}
+
+	for i := range paths {
+		if len(failures[i]) == 0 {
+			continue
+		}
+
+		if pkgs[i] == nil {
+			errs[i] = errors.New(strings.Join(failures[i], "; "))
+			continue
+		}
+
+		for _, f := range failures[i] {
+			s.reporter().Report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.UnscannedPlatform,
+				Message:  fmt.Sprintf("package %s will not be scanned for platform %s", pkgs[i].Path, f),
+			})
 		}
-		return nil, fmt.Errorf(strings.Join(lines, "\n"))
 	}
 
-	return pkgs, nil
+	return pkgs, errs
 }
 
-func (s *Scanner) scanPackage(path string) (*Package, error) {
-	files, err := getSourceFiles(path)
-	if err != nil {
+// scanPlatform scans the packages in the given paths using the loader of
+// a platform and returns the packages and errors found for every path in
+// the same position as their path.
+func (s *Scanner) scanPlatform(ctx context.Context, loader *loader, paths []string) ([]*Package, []error) {
+	var (
+		pkgs    = make([]*Package, len(paths))
+		errs    = make([]error, len(paths))
+		wg      = new(sync.WaitGroup)
+		jobs    = make(chan int)
+		workers = s.workers(len(paths))
+	)
+
+	loader.add(paths...)
+
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				pkgs[i], errs[i] = s.scanPackage(loader, paths[i])
+			}
+		}()
+	}
+
+enqueue:
+	for i := range paths {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break enqueue
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+	return pkgs, errs
+}
+
+func (s *Scanner) workers(jobs int) int {
+	n := s.Workers
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	if n > jobs {
+		n = jobs
+	}
+	return n
+}
+
+func (s *Scanner) scanPackage(l *loader, path string) (*Package, error) {
+	if err := l.ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	gopkg, err := parseSourceFiles(path, files)
+	p, err := l.load(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return buildPackage(gopkg)
+	reporter := s.reporter()
+	if sup, ok := reporter.(report.Suppressor); ok {
+		registerSuppressions(sup, l.fset, p.syntax)
+	}
+
+	return buildPackage(l.fset, p.pkg, p.syntax, s.Filter, reporter)
+}
+
+func (s *Scanner) reporter() report.Reporter {
+	if s.Reporter == nil {
+		return report.Default
+	}
+	return s.Reporter
 }
 
 func (p *Package) processObject(o types.Object) {
-	n, ok := o.Type().(*types.Named)
+	// Alias declarations (`type A = B`) do not define a new type, every
+	// reference to them is a reference to their target, so they must not
+	// end up being a struct or alias on their own.
+	if tn, ok := o.(*types.TypeName); ok && tn.IsAlias() {
+		return
+	}
+
+	if f, ok := o.(*types.Func); ok {
+		if p.service && f.Exported() {
+			p.processFunc(f, nil)
+		}
+		return
+	}
+
+	n, ok := types.Unalias(o.Type()).(*types.Named)
 	if !ok || !o.Exported() {
 		return
 	}
 
-	switch o.(type) {
-	case *types.Var, *types.Const:
-		if _, ok := n.Underlying().(*types.Basic); ok {
-			p.processEnumValue(o.Name(), n)
+	if _, ok := o.(*types.TypeName); ok && p.serviceTypes[o.Name()] {
+		p.processMethods(n)
+		return
+	}
+
+	switch o := o.(type) {
+	case *types.Var:
+		return
+	case *types.Const:
+		if b, ok := n.Underlying().(*types.Basic); ok {
+			if b.Info()&types.IsInteger != 0 {
+				p.processEnumValue(o, n)
+			} else {
+				p.reportNonEnum(o, n)
+			}
 		}
 		return
 	}
 
 	if s, ok := n.Underlying().(*types.Struct); ok {
 
-		st := processStruct(&Struct{Name: o.Name()}, s)
+		st := p.processStruct(&Struct{Name: o.Name(), Pos: p.position(o.Pos())}, s)
 		p.Structs = append(p.Structs, st)
 		return
 	}
 
-	p.Aliases[objName(n.Obj())] = processType(n.Underlying())
+	name := objName(n.Obj())
+	p.Aliases[name] = p.processType(n.Underlying(), location{p.position(o.Pos()), name})
+}
+
+// location is the place where a type is used, which is reported along
+// with the diagnostics about the type.
+type location struct {
+	pos token.Position
+	// typ is the qualified name of the type being processed.
+	typ string
 }
 
-func processType(typ types.Type) (t Type) {
+// processType returns the representation of the given type, which is used
+// at the given location, or nil if it can not be represented.
+func (p *Package) processType(typ types.Type, loc location) (t Type) {
 	switch u := typ.(type) {
 	case *types.Named:
-		t = NewNamed(
+		// Named types of the universe scope, such as error, have no
+		// package and can not be represented.
+		if u.Obj().Pkg() == nil {
+			p.unsupportedType(typ, loc)
+			return nil
+		}
+
+		t = &Named{
+			newBaseType(),
 			u.Obj().Pkg().Path(),
 			u.Obj().Name(),
-		)
+			findMarshaler(u),
+		}
+	case *types.Alias:
+		t = p.processType(types.Unalias(u), loc)
 	case *types.Basic:
 		t = NewBasic(u.Name())
 	case *types.Slice:
-		t = processType(u.Elem())
-		t.SetRepeated(true)
+		if t = p.processType(u.Elem(), loc); t != nil {
+			t.SetRepeated(true)
+		}
 	case *types.Array:
-		t = processType(u.Elem())
-		t.SetRepeated(true)
+		if t = p.processType(u.Elem(), loc); t != nil {
+			t.SetRepeated(true)
+		}
 	case *types.Pointer:
-		t = processType(u.Elem())
+		t = p.processType(u.Elem(), loc)
 	case *types.Map:
-		key := processType(u.Key())
-		val := processType(u.Elem())
+		key := p.processType(u.Key(), loc)
+		val := p.processType(u.Elem(), loc)
 		t = NewMap(key, val)
 	default:
-		report.Warn("ignoring type %s", typ.String())
+		p.unsupportedType(typ, loc)
 		return nil
 	}
 
 	return
 }
 
-func (p *Package) processEnumValue(name string, named *types.Named) {
+func (p *Package) unsupportedType(typ types.Type, loc location) {
+	p.report(&report.Diagnostic{
+		Severity: report.Warning,
+		Code:     report.UnsupportedType,
+		Message:  fmt.Sprintf("ignoring type %s", typ),
+		Pos:      loc.pos,
+		Type:     loc.typ,
+	})
+}
+
+// report sends the given diagnostic to the reporter of the package, if
+// there is any.
+func (p *Package) report(d *report.Diagnostic) {
+	if p.reporter != nil {
+		p.reporter.Report(d)
+	}
+}
+
+// position returns the position of the given pos in the file set of the
+// package, if there is any.
+func (p *Package) position(pos token.Pos) token.Position {
+	if p.fset == nil {
+		return token.Position{}
+	}
+	return p.fset.Position(pos)
+}
+
+// typeName returns the qualified name of the struct s of the package.
+func (p *Package) typeName(s *Struct) string {
+	return fmt.Sprintf("%s.%s", p.Path, s.Name)
+}
+
+// reportNonEnum reports that the constants of the given type, such as c,
+// do not make an enum because they are not integers, so the type is
+// represented as its underlying type.
+func (p *Package) reportNonEnum(c *types.Const, named *types.Named) {
 	typ := objName(named.Obj())
-	p.values[typ] = append(p.values[typ], name)
+	if p.nonEnums[typ] {
+		return
+	}
+
+	p.nonEnums[typ] = true
+	p.report(&report.Diagnostic{
+		Severity: report.Warning,
+		Code:     report.NonIntegerEnum,
+		Message:  fmt.Sprintf("constants of type %s are not an enum, as they are not integers, so it is represented as %s", typ, named.Underlying()),
+		Pos:      p.position(c.Pos()),
+		Type:     typ,
+	})
 }
 
-func processStruct(s *Struct, elem *types.Struct) *Struct {
+func (p *Package) processEnumValue(c *types.Const, named *types.Named) {
+	typ := objName(named.Obj())
+	n, exact := constant.Int64Val(c.Val())
+	if !exact {
+		p.report(&report.Diagnostic{
+			Severity: report.Warning,
+			Code:     report.UnsupportedType,
+			Message:  fmt.Sprintf("value %s of enum %s does not fit in an int64", c.Name(), typ),
+			Pos:      p.position(c.Pos()),
+			Type:     typ,
+		})
+		return
+	}
+
+	p.values[typ] = append(p.values[typ], c.Name())
+	p.numbers[c.Name()] = n
+}
+
+func (p *Package) processStruct(s *Struct, elem *types.Struct) *Struct {
 	for i := 0; i < elem.NumFields(); i++ {
 		v := elem.Field(i)
 		tags := findProtoTags(elem.Tag(i))
@@ -280,23 +638,37 @@ func processStruct(s *Struct, elem *types.Struct) *Struct {
 		// completely ignored and a warning is printed to give
 		// feedback to the user.
 		if s.HasField(v.Name()) {
-			report.Warn("struct %q already has a field %q", s.Name, v.Name())
+			p.report(&report.Diagnostic{
+				Severity: report.Warning,
+				Code:     report.DuplicateField,
+				Message:  fmt.Sprintf("struct %q already has a field %q", s.Name, v.Name()),
+				Pos:      p.position(v.Pos()),
+				Type:     p.typeName(s),
+			})
 			continue
 		}
 
 		if v.Anonymous() {
 			embedded := findStruct(v.Type())
 			if embedded == nil {
-				report.Warn("field %q with type %q is not a valid embedded type", v.Name(), v.Type())
+				p.report(&report.Diagnostic{
+					Severity: report.Warning,
+					Code:     report.InvalidEmbedded,
+					Message:  fmt.Sprintf("field %q with type %q is not a valid embedded type", v.Name(), v.Type()),
+					Pos:      p.position(v.Pos()),
+					Type:     p.typeName(s),
+				})
 			} else {
-				s = processStruct(s, embedded)
+				s = p.processStruct(s, embedded)
 			}
 			continue
 		}
 
 		f := &Field{
-			Name: v.Name(),
-			Type: processType(v.Type()),
+			Name:   v.Name(),
+			Type:   p.processFieldType(s, v),
+			Number: fieldNumber(tags),
+			Pos:    p.position(v.Pos()),
 		}
 		if f.Type == nil {
 			continue
@@ -308,10 +680,53 @@ func processStruct(s *Struct, elem *types.Struct) *Struct {
 	return s
 }
 
+// processFieldType returns the type of the given struct field. Unlike
+// processType, anonymous struct types are not ignored but converted into
+// a struct nested in s that is referenced by the returned type.
+func (p *Package) processFieldType(s *Struct, v *types.Var) Type {
+	elem, repeated := anonymousStruct(v.Type())
+	if elem == nil {
+		return p.processType(v.Type(), location{p.position(v.Pos()), p.typeName(s)})
+	}
+
+	nested := p.processStruct(&Struct{
+		Name: s.Name + "." + v.Name(),
+		Pos:  p.position(v.Pos()),
+	}, elem)
+	s.Nested = append(s.Nested, nested)
+
+	t := NewNamed(v.Pkg().Path(), nested.Name)
+	t.SetRepeated(repeated)
+	return t
+}
+
+// anonymousStruct returns the anonymous struct type behind the given type,
+// if any, and whether it is repeated or not.
+func anonymousStruct(t types.Type) (*types.Struct, bool) {
+	switch elem := t.(type) {
+	case *types.Pointer:
+		return anonymousStruct(elem.Elem())
+	case *types.Slice:
+		st, _ := anonymousStruct(elem.Elem())
+		return st, true
+	case *types.Array:
+		st, _ := anonymousStruct(elem.Elem())
+		return st, true
+	case *types.Alias:
+		return anonymousStruct(types.Unalias(elem))
+	case *types.Struct:
+		return elem, false
+	default:
+		return nil, false
+	}
+}
+
 func findStruct(t types.Type) *types.Struct {
 	switch elem := t.(type) {
 	case *types.Pointer:
 		return findStruct(elem.Elem())
+	case *types.Alias:
+		return findStruct(types.Unalias(elem))
 	case *types.Named:
 		return findStruct(elem.Underlying())
 	case *types.Struct:
@@ -327,9 +742,15 @@ func (p *Package) collectEnums() {
 			idx := strings.LastIndex(k, ".")
 			name := k[idx+1:]
 
+			numbers := make(map[string]int64, len(vals))
+			for _, v := range vals {
+				numbers[v] = p.numbers[v]
+			}
+
 			p.Enums = append(p.Enums, &Enum{
-				Name:   name,
-				Values: vals,
+				Name:    name,
+				Values:  vals,
+				Numbers: numbers,
 			})
 
 			delete(p.Aliases, k)
@@ -341,17 +762,24 @@ func isIgnoredField(f *types.Var, tags []string) bool {
 	return !f.Exported() || (len(tags) > 0 && tags[0] == "-")
 }
 
-func buildPackage(gopkg *types.Package) (*Package, error) {
+func buildPackage(fset *token.FileSet, gopkg *types.Package, files []*ast.File, filter *TypeFilter, reporter report.Reporter) (*Package, error) {
 	objs := objectsInScope(gopkg.Scope())
 
 	pkg := &Package{
-		Path:    gopkg.Path(),
-		Name:    gopkg.Name(),
-		values:  make(map[string][]string),
-		Aliases: make(map[string]Type),
+		Path:     gopkg.Path(),
+		Name:     gopkg.Name(),
+		values:   make(map[string][]string),
+		numbers:  make(map[string]int64),
+		nonEnums: make(map[string]bool),
+		Aliases:  make(map[string]Type),
+		fset:     fset,
+		reporter: reporter,
+		service:  isService(files),
+
+		serviceTypes: serviceTypes(files),
 	}
 
-	for _, o := range objs {
+	for _, o := range filter.filterObjects(pkg.Path, objs, pkg.serviceTypes, pkg.service) {
 		pkg.processObject(o)
 	}
 
@@ -366,10 +794,10 @@ func objectsInScope(scope *types.Scope) (objs []types.Object) {
 	return
 }
 
-func getSourceFiles(path string) ([]string, error) {
-	pkg, err := build.ImportDir(path, 0)
+func getSourceFiles(ctx build.Context, path string) (*build.Package, []string, error) {
+	pkg, err := ctx.ImportDir(path, 0)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var filenames []string
@@ -377,7 +805,7 @@ func getSourceFiles(path string) ([]string, error) {
 	filenames = append(filenames, pkg.CgoFiles...)
 
 	if len(filenames) == 0 {
-		return nil, fmt.Errorf("no go source files in path: %s", path)
+		return nil, nil, fmt.Errorf("no go source files in path: %s", path)
 	}
 
 	var paths []string
@@ -385,14 +813,17 @@ func getSourceFiles(path string) ([]string, error) {
 		paths = append(paths, filepath.Join(path, f))
 	}
 
-	return paths, nil
+	return pkg, paths, nil
 }
 
-func parseSourceFiles(root string, paths []string) (*types.Package, error) {
+func parseSourceFiles(ctx context.Context, fs *token.FileSet, paths []string, o overlay) ([]*ast.File, error) {
 	var files []*ast.File
-	fs := token.NewFileSet()
 	for _, p := range paths {
-		f, err := parser.ParseFile(fs, p, nil, 0)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		f, err := parser.ParseFile(fs, p, o.source(p), parser.ParseComments)
 		if err != nil {
 			return nil, err
 		}
@@ -400,9 +831,7 @@ func parseSourceFiles(root string, paths []string) (*types.Package, error) {
 		files = append(files, f)
 	}
 
-	config := types.Config{Importer: importer.For("gc", nil)}
-
-	return config.Check(root, fs, files, new(types.Info))
+	return files, nil
 }
 
 func objName(obj types.Object) string {
@@ -1,13 +1,16 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
+	"go/build"
 	"go/token"
 	"go/types"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/src-d/proteus/report"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,7 +19,7 @@ var gopath = os.Getenv("GOPATH")
 const project = "github.com/src-d/proteus"
 
 func TestGetSourceFiles(t *testing.T) {
-	paths, err := getSourceFiles(projectPath("fixtures"))
+	_, paths, err := getSourceFiles(build.Default, projectPath("fixtures"))
 	require.Nil(t, err)
 	expected := []string{
 		projectPath("fixtures/bar.go"),
@@ -30,16 +33,23 @@ func projectPath(pkg string) string {
 	return filepath.Join(gopath, "src", project, pkg)
 }
 
+func importPath(pkg string) string {
+	return project + "/" + pkg
+}
+
 func TestParseSourceFiles(t *testing.T) {
 	paths := []string{
 		projectPath("fixtures/bar.go"),
 		projectPath("fixtures/foo.go"),
 	}
 
-	pkg, err := parseSourceFiles(projectPath("fixtures"), paths)
+	files, err := parseSourceFiles(context.Background(), token.NewFileSet(), paths, nil)
 	require.Nil(t, err)
 
-	require.Equal(t, "foo", pkg.Name())
+	require.Equal(t, 2, len(files))
+	for _, f := range files {
+		require.Equal(t, "foo", f.Name.Name)
+	}
 }
 
 func TestProcessType(t *testing.T) {
@@ -89,6 +99,14 @@ func TestProcessType(t *testing.T) {
 				NewNamed("/foo/bar", "Bar"),
 			),
 		},
+		{
+			"alias of named type",
+			types.NewAlias(
+				types.NewTypeName(token.NoPos, types.NewPackage("/foo/baz", "mock"), "Baz", nil),
+				newNamed("/foo/bar", "Bar", nil),
+			),
+			NewNamed("/foo/bar", "Bar"),
+		},
 		{
 			"struct",
 			types.NewStruct(nil, nil),
@@ -99,10 +117,20 @@ func TestProcessType(t *testing.T) {
 			types.NewInterface(nil, nil),
 			nil,
 		},
+		{
+			"error",
+			types.Universe.Lookup("error").Type(),
+			nil,
+		},
+		{
+			"slice of unsupported type",
+			types.NewSlice(types.NewChan(types.SendRecv, types.Typ[types.Int])),
+			nil,
+		},
 	}
 
 	for _, c := range cases {
-		require.Equal(t, c.expected, processType(c.typ), c.name)
+		require.Equal(t, c.expected, new(Package).processType(c.typ, location{}), c.name)
 	}
 }
 
@@ -123,8 +151,8 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
-					{"Bar", NewBasic("string")},
+					{Name: "Foo", Type: NewBasic("int")},
+					{Name: "Bar", Type: NewBasic("string")},
 				},
 			},
 		},
@@ -139,7 +167,7 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
+					{Name: "Foo", Type: NewBasic("int")},
 				},
 			},
 		},
@@ -154,7 +182,7 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
+					{Name: "Foo", Type: NewBasic("int")},
 				},
 			},
 		},
@@ -163,13 +191,13 @@ func TestProcessStruct(t *testing.T) {
 			types.NewStruct(
 				[]*types.Var{
 					mkField("Foo", types.Typ[types.Int], false),
-					mkField("Bar", types.NewStruct(nil, nil), false),
+					mkField("Bar", types.NewInterface(nil, nil), false),
 				},
 				nil,
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
+					{Name: "Foo", Type: NewBasic("int")},
 				},
 			},
 		},
@@ -194,9 +222,9 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
-					{"Bar", NewBasic("string")},
-					{"Baz", NewBasic("uint64")},
+					{Name: "Foo", Type: NewBasic("int")},
+					{Name: "Bar", Type: NewBasic("string")},
+					{Name: "Baz", Type: NewBasic("uint64")},
 				},
 			},
 		},
@@ -221,8 +249,8 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
-					{"Bar", NewBasic("string")},
+					{Name: "Foo", Type: NewBasic("int")},
+					{Name: "Bar", Type: NewBasic("string")},
 				},
 			},
 		},
@@ -249,9 +277,9 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Foo", NewBasic("int")},
-					{"Bar", NewBasic("string")},
-					{"Baz", NewBasic("uint64")},
+					{Name: "Foo", Type: NewBasic("int")},
+					{Name: "Bar", Type: NewBasic("string")},
+					{Name: "Baz", Type: NewBasic("uint64")},
 				},
 			},
 		},
@@ -266,15 +294,74 @@ func TestProcessStruct(t *testing.T) {
 			),
 			&Struct{
 				Fields: []*Field{
-					{"Baz", NewBasic("uint64")},
+					{Name: "Baz", Type: NewBasic("uint64")},
 				},
 			},
 		},
 	}
 
 	for _, c := range cases {
-		require.Equal(t, c.expected, processStruct(&Struct{}, c.elem), c.name)
+		require.Equal(t, c.expected, new(Package).processStruct(&Struct{}, c.elem), c.name)
+	}
+}
+
+func TestProcessStructInlineStruct(t *testing.T) {
+	elem := types.NewStruct(
+		[]*types.Var{
+			mkField("Config", types.NewStruct(
+				[]*types.Var{
+					mkField("Host", types.Typ[types.String], false),
+					mkField("TLS", types.NewPointer(types.NewStruct(
+						[]*types.Var{
+							mkField("Cert", types.Typ[types.String], false),
+						},
+						nil,
+					)), false),
+				},
+				nil,
+			), false),
+			mkField("Items", types.NewSlice(types.NewStruct(
+				[]*types.Var{
+					mkField("ID", types.Typ[types.Int], false),
+				},
+				nil,
+			)), false),
+		},
+		nil,
+	)
+
+	expected := &Struct{
+		Name: "Foo",
+		Fields: []*Field{
+			{Name: "Config", Type: NewNamed("/foo", "Foo.Config")},
+			{Name: "Items", Type: repeated(NewNamed("/foo", "Foo.Items"))},
+		},
+		Nested: []*Struct{
+			{
+				Name: "Foo.Config",
+				Fields: []*Field{
+					{Name: "Host", Type: NewBasic("string")},
+					{Name: "TLS", Type: NewNamed("/foo", "Foo.Config.TLS")},
+				},
+				Nested: []*Struct{
+					{
+						Name: "Foo.Config.TLS",
+						Fields: []*Field{
+							{Name: "Cert", Type: NewBasic("string")},
+						},
+					},
+				},
+			},
+			{
+				Name: "Foo.Items",
+				Fields: []*Field{
+					{Name: "ID", Type: NewBasic("int")},
+				},
+			},
+		},
 	}
+
+	require.Equal(t, expected, new(Package).processStruct(&Struct{Name: "Foo"}, elem))
 }
 
 func TestScanner(t *testing.T) {
@@ -292,13 +379,19 @@ func TestScanner(t *testing.T) {
 
 	require.Equal(3, len(pkg.Structs), "pkg")
 	assertStruct(t, pkg.Structs[0], "Bar", "Bar", "Baz")
-	assertStruct(t, pkg.Structs[1], "Foo", "Bar", "Baz", "IntList", "IntArray", "Map", "Timestamp", "External", "Duration", "Aliased")
+	assertStruct(t, pkg.Structs[1], "Foo", "Bar", "Baz", "IntList", "IntArray", "Map", "Timestamp", "External", "Duration", "AliasQux", "Aliased")
 	assertStruct(t, pkg.Structs[2], "Qux", "A", "B")
 
+	aliasQux := pkg.Structs[1].Fields[8]
+	require.Equal("AliasQux", aliasQux.Name)
+	require.Equal(NewNamed(importPath("fixtures"), "Qux"), aliasQux.Type, "alias should be resolved to its target")
+	_, ok := pkg.Aliases[fmt.Sprintf("%s.%s", importPath("fixtures"), "QuxAlias")]
+	require.False(ok, "QuxAlias should not be an alias")
+
 	require.Equal(1, len(subpkg.Structs), "subpkg")
 	assertStruct(t, subpkg.Structs[0], "Point", "X", "Y")
 
-	_, ok := pkg.Aliases[fmt.Sprintf("%s.%s", projectPath("fixtures"), "Baz")]
+	_, ok = pkg.Aliases[fmt.Sprintf("%s.%s", importPath("fixtures"), "Baz")]
 	require.False(ok, "Baz should not be an alias anymore")
 
 	require.Equal(1, len(pkg.Enums), "pkg enums")
@@ -311,6 +404,1062 @@ func TestScanner(t *testing.T) {
 	)
 }
 
+func TestScannerWorkers(t *testing.T) {
+	require := require.New(t)
+
+	scanner, err := New(
+		projectPath("fixtures"),
+		projectPath("fixtures/subpkg"),
+		projectPath("fixtures"),
+	)
+	require.Nil(err)
+	scanner.Workers = 1
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(3, len(pkgs), "scan packages")
+	require.Equal("foo", pkgs[0].Name)
+	require.Equal("subpkg", pkgs[1].Name)
+	require.Equal("foo", pkgs[2].Name)
+}
+
+func TestScannerCancelled(t *testing.T) {
+	scanner, err := New(projectPath("fixtures"), projectPath("fixtures/subpkg"))
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pkgs, err := scanner.ScanContext(ctx)
+	require.Equal(t, context.Canceled, err)
+	require.Nil(t, pkgs)
+}
+
+func TestScannerPartialResults(t *testing.T) {
+	require := require.New(t)
+
+	broken := filepath.Join(os.TempDir(), "proteus-overlay", "broken")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(broken, "broken.go"): []byte(`package broken
+
+type Foo struct {
+	Bar UndefinedType
+}
+`),
+	}, projectPath("fixtures"), broken, projectPath("fixtures/subpkg"))
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.NotNil(err)
+	require.Equal(2, len(pkgs), "scan packages")
+	require.Equal("foo", pkgs[0].Name)
+	require.Equal("subpkg", pkgs[1].Name)
+
+	scanErr, ok := err.(*ScanError)
+	require.True(ok, "error should be a *ScanError")
+	require.Equal([]string{broken}, scanErr.Paths())
+	require.NotNil(scanErr.Errors[0].Err)
+}
+
+func TestScannerDiagnostics(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "diagnostics")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package diagnostics
+
+type Base struct {
+	Name string
+}
+
+type Foo struct {
+	Base
+	Name string
+	Ch   chan int
+	int
+}
+`),
+	}, path)
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	_, err = scanner.Scan()
+	require.Nil(err)
+
+	diagnostics := collector.Diagnostics()
+	require.Equal(2, len(diagnostics))
+
+	require.Equal(report.DuplicateField, diagnostics[0].Code)
+	require.Equal(report.Warning, diagnostics[0].Severity)
+	require.Equal(9, diagnostics[0].Pos.Line)
+	require.Equal(path+".Foo", diagnostics[0].Type)
+
+	require.Equal(report.UnsupportedType, diagnostics[1].Code)
+	require.Equal(filepath.Join(path, "foo.go"), diagnostics[1].Pos.Filename)
+	require.Equal(10, diagnostics[1].Pos.Line)
+	require.Equal(path+".Foo", diagnostics[1].Type)
+}
+
+func TestScannerNumbers(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "numbers")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package numbers
+
+type Foo struct {
+	Name string ` + "`proto:\"3\"`" + `
+	Kind Kind
+}
+
+type Kind uint8
+
+const (
+	Reader Kind = 4
+	Admin  Kind = 1
+)
+
+var Default Kind = Admin
+
+type Color string
+
+const Red Color = "red"
+`),
+	}, path)
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	pkg := pkgs[0]
+
+	require.Equal(1, len(pkg.Structs))
+	require.Equal(3, pkg.Structs[0].Fields[0].Number)
+	require.Equal(0, pkg.Structs[0].Fields[1].Number)
+
+	require.Equal(1, len(pkg.Enums), "only integer constants make enums")
+	require.Equal("Kind", pkg.Enums[0].Name)
+	require.Equal([]string{"Admin", "Reader"}, pkg.Enums[0].Values)
+	require.Equal(map[string]int64{"Admin": 1, "Reader": 4}, pkg.Enums[0].Numbers)
+}
+
+func TestScannerNonIntegerEnum(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "nonenum")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "color.go"): []byte(`package nonenum
+
+type Color string
+
+const (
+	Red  Color = "red"
+	Blue Color = "blue"
+)
+`),
+	}, path)
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	pkg := pkgs[0]
+
+	require.Equal(0, len(pkg.Enums))
+	require.Equal(NewBasic("string"), pkg.Aliases[path+".Color"])
+
+	diagnostics := collector.Diagnostics()
+	require.Equal(1, len(diagnostics), "it is reported once per type")
+	require.Equal(report.NonIntegerEnum, diagnostics[0].Code)
+	require.Equal(report.Warning, diagnostics[0].Severity)
+	require.Equal(path+".Color", diagnostics[0].Type)
+	require.Equal(
+		"constants of type "+path+".Color are not an enum, as they are not integers, so it is represented as string",
+		diagnostics[0].Message,
+	)
+}
+
+func TestScannerSuppressions(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "suppressions")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package suppressions
+
+type Foo struct {
+	//proteus:ignore unsupported-type
+	Ch   chan int
+	Fn   func() //proteus:ignore unsupported-type
+	Err  error
+	Name string //proteus:ignore removed-field
+}
+
+//proteus:ignore unsupported-type
+type Bar struct {
+	Ch chan int
+	Inline struct {
+		Fn func()
+	}
+}
+`),
+	}, path)
+	require.Nil(err)
+
+	var collector report.Collector
+	filter := report.NewSuppressionFilter(&collector)
+	scanner.Reporter = filter
+	_, err = scanner.Scan()
+	require.Nil(err)
+
+	diagnostics := collector.Diagnostics()
+	require.Equal(1, len(diagnostics))
+	require.Equal(report.UnsupportedType, diagnostics[0].Code)
+	require.Equal(7, diagnostics[0].Pos.Line)
+
+	filter.ReportUnused()
+	diagnostics = collector.Diagnostics()
+	require.Equal(2, len(diagnostics))
+	require.Equal(report.UnusedSuppression, diagnostics[1].Code)
+	require.Equal(8, diagnostics[1].Pos.Line)
+}
+
+func TestScannerFuncs(t *testing.T) {
+	require := require.New(t)
+
+	svc := filepath.Join(os.TempDir(), "proteus-overlay", "svc")
+	nosvc := filepath.Join(os.TempDir(), "proteus-overlay", "nosvc")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(svc, "doc.go"): []byte(`// Package svc is a service.
+//proteus:service
+package svc
+`),
+		filepath.Join(svc, "svc.go"): []byte(`package svc
+
+type Point struct {
+	X, Y int
+}
+
+func Move(p Point, dx, dy int) Point {
+	return p
+}
+
+func Names(_ []Point) (names []string, count int) {
+	return
+}
+
+func Variadic(p ...Point) {}
+
+func Chan(c chan int) {}
+
+func unexported(p Point) {}
+
+func (p Point) Method() {}
+`),
+		filepath.Join(nosvc, "nosvc.go"): []byte(`package nosvc
+
+func Move(x int) int {
+	return x
+}
+`),
+	}, svc, nosvc)
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(2, len(pkgs))
+	require.Equal(0, len(pkgs[1].Funcs), "funcs of packages not opted in are not scanned")
+
+	funcs := pkgs[0].Funcs
+	require.Equal(2, len(funcs))
+
+	require.Equal("Move", funcs[0].Name)
+	require.Equal(7, funcs[0].Pos.Line)
+	require.Equal([]*Field{
+		{Name: "p", Type: NewNamed(svc, "Point"), Pos: funcs[0].Params[0].Pos},
+		{Name: "dx", Type: NewBasic("int"), Pos: funcs[0].Params[1].Pos},
+		{Name: "dy", Type: NewBasic("int"), Pos: funcs[0].Params[2].Pos},
+	}, funcs[0].Params)
+	require.Equal([]*Field{
+		{Type: NewNamed(svc, "Point"), Pos: funcs[0].Results[0].Pos},
+	}, funcs[0].Results)
+	require.Equal("func(p "+svc+".Point, dx int, dy int) "+svc+".Point", funcs[0].Signature.String())
+
+	require.Equal("Names", funcs[1].Name)
+	require.Equal("", funcs[1].Params[0].Name)
+	require.Equal(repeated(NewNamed(svc, "Point")), funcs[1].Params[0].Type)
+	require.Equal("names", funcs[1].Results[0].Name)
+	require.Equal("count", funcs[1].Results[1].Name)
+
+	var codes []report.Code
+	for _, d := range collector.Diagnostics() {
+		codes = append(codes, d.Code)
+	}
+	require.Equal([]report.Code{report.InvalidRPC, report.InvalidRPC}, codes)
+}
+
+func TestScannerFuncsContextError(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "ctxerr")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "ctxerr.go"): []byte(`//proteus:service
+package ctxerr
+
+import "context"
+
+func Get(ctx context.Context, id int) (string, error) {
+	return "", nil
+}
+
+func Ping(context.Context) error {
+	return nil
+}
+
+func Plain(id int) int {
+	return id
+}
+
+func LateContext(id int, ctx context.Context) int {
+	return id
+}
+
+func EarlyError() (error, int) {
+	return nil, 0
+}
+`),
+	}, path)
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+
+	funcs := pkgs[0].Funcs
+	require.Equal(3, len(funcs))
+
+	get := funcs[0]
+	require.Equal("Get", get.Name)
+	require.True(get.Context)
+	require.True(get.Error)
+	require.Equal([]*Field{
+		{Name: "id", Type: NewBasic("int"), Pos: get.Params[0].Pos},
+	}, get.Params)
+	require.Equal([]*Field{
+		{Type: NewBasic("string"), Pos: get.Results[0].Pos},
+	}, get.Results)
+
+	ping := funcs[1]
+	require.Equal("Ping", ping.Name)
+	require.True(ping.Context)
+	require.True(ping.Error)
+	require.Equal(0, len(ping.Params))
+	require.Equal(0, len(ping.Results))
+
+	plain := funcs[2]
+	require.False(plain.Context)
+	require.False(plain.Error)
+
+	var messages []string
+	for _, d := range collector.Diagnostics() {
+		require.Equal(report.InvalidRPC, d.Code)
+		messages = append(messages, d.Message)
+	}
+	require.Equal([]string{
+		"function EarlyError will not be an RPC because its result #1 is an error, which can only be the last result",
+		`function LateContext will not be an RPC because its parameter "ctx" is a context.Context, which can only be the first parameter`,
+	}, messages)
+}
+
+func TestScannerFuncsStreams(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "streams")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "streams.go"): []byte(`//proteus:service
+package streams
+
+import "context"
+
+type Event struct {
+	Name string
+}
+
+func Feed(ctx context.Context, topic string) (<-chan Event, error) {
+	return nil, nil
+}
+
+func Watch(ctx context.Context, topic string, events chan<- Event) error {
+	return nil
+}
+
+func Publish(ctx context.Context, events <-chan Event) (int, error) {
+	return 0, nil
+}
+
+func Chat(in <-chan string, out chan<- string) {}
+
+func Both(events chan Event) {}
+
+func SendResult() chan<- Event {
+	return nil
+}
+
+func TwoFeeds() (<-chan Event, <-chan Event) {
+	return nil, nil
+}
+
+func Mixed(id int, events <-chan Event) {}
+
+func FeedCount() (<-chan Event, int) {
+	return nil, 0
+}
+`),
+	}, path)
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+
+	var names []string
+	for _, f := range pkgs[0].Funcs {
+		names = append(names, f.Name)
+	}
+	require.Equal([]string{"Chat", "Feed", "Publish", "Watch"}, names)
+
+	chat := pkgs[0].Funcs[0]
+	require.Equal(&Stream{
+		Field: &Field{Name: "in", Type: NewBasic("string"), Pos: chat.ClientStream.Field.Pos},
+	}, chat.ClientStream)
+	require.Equal(&Stream{
+		Field: &Field{Name: "out", Type: NewBasic("string"), Pos: chat.ServerStream.Field.Pos},
+		Index: 1,
+	}, chat.ServerStream)
+
+	feed := pkgs[0].Funcs[1]
+	require.Nil(feed.ClientStream)
+	require.Equal(&Stream{
+		Field:  &Field{Type: NewNamed(path, "Event"), Pos: feed.ServerStream.Field.Pos},
+		Result: true,
+	}, feed.ServerStream)
+	require.Equal(1, len(feed.Params))
+	require.Equal(0, len(feed.Results))
+
+	publish := pkgs[0].Funcs[2]
+	require.Equal("events", publish.ClientStream.Field.Name)
+	require.Nil(publish.ServerStream)
+	require.Equal(0, len(publish.Params))
+	require.Equal(1, len(publish.Results))
+
+	watch := pkgs[0].Funcs[3]
+	require.Nil(watch.ClientStream)
+	require.Equal(&Stream{
+		Field: &Field{Name: "events", Type: NewNamed(path, "Event"), Pos: watch.ServerStream.Field.Pos},
+		Index: 1,
+	}, watch.ServerStream)
+	require.Equal(2, len(watch.Fields()))
+
+	var messages []string
+	for _, d := range collector.Diagnostics() {
+		require.Equal(report.InvalidRPC, d.Code)
+		messages = append(messages, d.Message)
+	}
+	require.Equal([]string{
+		`function Both will not be an RPC because its parameter "events" is a bidirectional channel, whose direction can not be streamed`,
+		"function FeedCount will not be an RPC because it has other results besides the server stream",
+		"function Mixed will not be an RPC because it has other parameters besides the client stream",
+		"function SendResult will not be an RPC because its result #1 is a send-only channel, which can not be streamed",
+		"function TwoFeeds will not be an RPC because it has more than one server stream",
+	}, messages)
+}
+
+// TestScannerFuncsSendParamStream pins that a `chan<- T` parameter is a
+// server stream, as the function sends its values, and never a client
+// stream, even when it is the only parameter.
+func TestScannerFuncsSendParamStream(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "sendparam")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "sendparam.go"): []byte(`//proteus:service
+package sendparam
+
+func Count(out chan<- int) {}
+`),
+	}, path)
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(1, len(pkgs[0].Funcs))
+
+	count := pkgs[0].Funcs[0]
+	require.Nil(count.ClientStream)
+	require.Equal(&Stream{
+		Field: &Field{Name: "out", Type: NewBasic("int"), Pos: count.ServerStream.Field.Pos},
+	}, count.ServerStream)
+}
+
+func TestScannerMethods(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "methods")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "methods.go"): []byte(`package methods
+
+type User struct {
+	ID   int
+	Name string
+}
+
+// UserStore stores users.
+//proteus:service
+type UserStore struct {
+	users map[int]User
+}
+
+func (s *UserStore) Get(id int) User {
+	return s.users[id]
+}
+
+func (s UserStore) Count() int {
+	return len(s.users)
+}
+
+func (s *UserStore) put(u User) {}
+
+type (
+	//proteus:service
+	Greeter interface {
+		Greet(name string) string
+	}
+
+	Cache struct {
+		Size int
+	}
+)
+
+//proteus:service
+type Set[T any] struct{}
+
+func (Set[T]) Len() int { return 0 }
+
+func (c Cache) Clear() {}
+
+func Unexposed(id int) User {
+	return User{}
+}
+`),
+	}, path)
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(1, len(pkgs))
+
+	var structs []string
+	for _, s := range pkgs[0].Structs {
+		structs = append(structs, s.Name)
+	}
+	require.Equal([]string{"Cache", "User"}, structs, "service types are not structs")
+
+	var names []string
+	for _, f := range pkgs[0].Funcs {
+		names = append(names, f.FullName())
+	}
+	require.Equal([]string{"Greeter.Greet", "UserStore.Count", "UserStore.Get"}, names)
+
+	greet := pkgs[0].Funcs[0]
+	require.Equal("Greeter", greet.Receiver.Name)
+	require.False(greet.Receiver.Pointer)
+	require.Equal(26, greet.Receiver.Pos.Line)
+	require.Equal([]*Field{
+		{Name: "name", Type: NewBasic("string"), Pos: greet.Params[0].Pos},
+	}, greet.Params)
+
+	get := pkgs[0].Funcs[2]
+	require.Equal("UserStore", get.Receiver.Name)
+	require.True(get.Receiver.Pointer)
+	require.True(get.Receiver == pkgs[0].Funcs[1].Receiver, "methods share receiver")
+	require.Equal(14, get.Pos.Line)
+	require.Equal([]*Field{
+		{Type: NewNamed(path, "User"), Pos: get.Results[0].Pos},
+	}, get.Results)
+
+	require.Equal(1, len(collector.Diagnostics()))
+	require.Equal(report.InvalidRPC, collector.Diagnostics()[0].Code)
+	require.Equal(path+".Set", collector.Diagnostics()[0].Type)
+}
+
+func TestScannerSharedTypes(t *testing.T) {
+	require := require.New(t)
+
+	a, b := projectPath("fixtures/overlay/a"), projectPath("fixtures/overlay/b")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(a, "a.go"): []byte(`package a
+
+type A struct {
+	Name string
+}
+`),
+		filepath.Join(b, "b.go"): []byte(`package b
+
+import "github.com/src-d/proteus/fixtures/overlay/a"
+
+type B struct {
+	A *a.A
+}
+`),
+	}, b, a)
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(2, len(pkgs), "scan packages")
+	require.Equal(importPath("fixtures/overlay/b"), pkgs[0].Path)
+	require.Equal(importPath("fixtures/overlay/a"), pkgs[1].Path)
+
+	assertStruct(t, pkgs[0].Structs[0], "B", "A")
+	require.Equal(NewNamed(pkgs[1].Path, "A"), pkgs[0].Structs[0].Fields[0].Type)
+}
+
+func TestScannerImportCycle(t *testing.T) {
+	require := require.New(t)
+
+	a, b := projectPath("fixtures/overlay/a"), projectPath("fixtures/overlay/b")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(a, "a.go"): []byte(`package a
+
+import "github.com/src-d/proteus/fixtures/overlay/b"
+
+type A struct {
+	B *b.B
+}
+`),
+		filepath.Join(b, "b.go"): []byte(`package b
+
+import "github.com/src-d/proteus/fixtures/overlay/a"
+
+type B struct {
+	A *a.A
+}
+`),
+	}, a, b, projectPath("fixtures/subpkg"))
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.NotNil(err)
+	require.Equal(1, len(pkgs), "scan packages")
+	require.Equal([]string{a, b}, err.(*ScanError).Paths())
+}
+
+func TestScannerPlatforms(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "platforms")
+	overlay := map[string][]byte{
+		filepath.Join(path, "os_linux.go"): []byte(`package platforms
+
+type OS struct {
+	Name  string
+	Linux int
+}
+
+type Linux struct{}
+`),
+		filepath.Join(path, "os_windows.go"): []byte(`package platforms
+
+type OS struct {
+	Name    string
+	Windows int
+}
+`),
+		filepath.Join(path, "extra.go"): []byte(`//go:build extra
+
+package platforms
+
+type Extra struct{}
+`),
+		filepath.Join(path, "doc.go"): []byte(`package platforms`),
+	}
+
+	cases := []struct {
+		name      string
+		platforms []Platform
+		structs   []string
+		fields    []string
+	}{
+		{
+			"linux",
+			[]Platform{{GOOS: "linux", GOARCH: "amd64"}},
+			[]string{"Linux", "OS"},
+			[]string{"Name", "Linux"},
+		},
+		{
+			"windows with tags",
+			[]Platform{{GOOS: "windows", GOARCH: "amd64", Tags: []string{"extra"}}},
+			[]string{"Extra", "OS"},
+			[]string{"Name", "Windows"},
+		},
+		{
+			"merged",
+			[]Platform{
+				{GOOS: "linux", GOARCH: "amd64"},
+				{GOOS: "windows", GOARCH: "386"},
+			},
+			[]string{"Linux", "OS"},
+			[]string{"Name", "Linux", "Windows"},
+		},
+	}
+
+	for _, c := range cases {
+		scanner, err := NewWithOverlay(overlay, path)
+		require.Nil(t, err, c.name)
+		scanner.Platforms = c.platforms
+
+		pkgs, err := scanner.Scan()
+		require.Nil(t, err, c.name)
+		require.Equal(t, 1, len(pkgs), c.name)
+
+		var names []string
+		for _, s := range pkgs[0].Structs {
+			names = append(names, s.Name)
+		}
+		require.Equal(t, c.structs, names, c.name)
+		assertStruct(t, pkgs[0].Structs[len(names)-1], "OS", c.fields...)
+	}
+}
+
+func TestScannerPlatformsWithoutSources(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "linuxonly")
+	overlay := map[string][]byte{
+		filepath.Join(path, "os_linux.go"): []byte(`package linuxonly
+
+type OS struct {
+	Name string
+}
+`),
+	}
+
+	scanner, err := NewWithOverlay(overlay, path)
+	require.Nil(err)
+	scanner.Platforms = []Platform{
+		{GOOS: "windows", GOARCH: "amd64"},
+		{GOOS: "linux", GOARCH: "amd64"},
+	}
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err, "platforms without sources are ignored")
+	require.Equal(1, len(pkgs))
+	assertStruct(t, pkgs[0].Structs[0], "OS", "Name")
+
+	diagnostics := collector.Diagnostics()
+	require.Equal(1, len(diagnostics), "the failing platform is reported")
+	require.Equal(report.UnscannedPlatform, diagnostics[0].Code)
+	require.Equal(report.Warning, diagnostics[0].Severity)
+	require.Contains(diagnostics[0].Message, "package "+path+" will not be scanned for platform windows/amd64: ")
+
+	scanner, err = NewWithOverlay(overlay, path)
+	require.Nil(err)
+	scanner.Platforms = []Platform{
+		{GOOS: "windows", GOARCH: "amd64"},
+		{GOOS: "darwin", GOARCH: "arm64"},
+	}
+
+	pkgs, err = scanner.Scan()
+	require.NotNil(err, "a package fails if it fails for every platform")
+	require.Equal(0, len(pkgs))
+	require.Equal([]string{path}, err.(*ScanError).Paths())
+	require.Contains(err.Error(), "windows/amd64")
+	require.Contains(err.Error(), "darwin/arm64")
+}
+
+func TestTypeFilter(t *testing.T) {
+	filter, err := NewTypeFilter(
+		[]string{"/^Foo/", "bar.Baz", "Qux"},
+		[]string{"FooDTO", "/^foo\\.FooInternal/"},
+	)
+	require.Nil(t, err)
+
+	cases := []struct {
+		path, name string
+		result     bool
+	}{
+		{"foo", "Foo", true},
+		{"foo", "FooBar", true},
+		{"foo", "FooDTO", false},
+		{"foo", "FooInternalThing", false},
+		{"bar", "FooInternalThing", true},
+		{"bar", "Baz", true},
+		{"foo", "Baz", false},
+		{"foo", "Qux", true},
+		{"foo", "Bar", false},
+	}
+
+	for _, c := range cases {
+		require.Equal(t, c.result, filter.Match(c.path, c.name), "%s.%s", c.path, c.name)
+	}
+
+	require.True(t, (*TypeFilter)(nil).Match("foo", "Bar"), "nil filter")
+
+	_, err = NewTypeFilter(nil, []string{"/[/"})
+	require.NotNil(t, err)
+}
+
+func TestScannerFilter(t *testing.T) {
+	require := require.New(t)
+
+	scanner, err := New(projectPath("fixtures"))
+	require.Nil(err)
+	scanner.Filter, err = NewTypeFilter(nil, []string{"Bar", "/^Ba/"})
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(2, len(pkgs[0].Structs), "pkg")
+	assertStruct(t, pkgs[0].Structs[0], "Foo", "Bar", "Baz", "IntList", "IntArray", "Map", "Timestamp", "External", "Duration", "AliasQux", "Aliased")
+	assertStruct(t, pkgs[0].Structs[1], "Qux", "A", "B")
+	require.Equal(0, len(pkgs[0].Enums), "pkg enums")
+}
+
+func TestScannerFilterDiagnostics(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "filtered")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package filtered
+
+type Foo struct {
+	Name string
+}
+
+type Internal struct {
+	Ch chan int
+}
+
+type Handler func()
+`),
+	}, path)
+	require.Nil(err)
+	scanner.Filter, err = NewTypeFilter(nil, []string{"Internal", "Handler"})
+	require.Nil(err)
+
+	var collector report.Collector
+	scanner.Reporter = &collector
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(1, len(pkgs[0].Structs))
+	require.Equal("Foo", pkgs[0].Structs[0].Name)
+	require.Equal(0, len(pkgs[0].Aliases))
+	require.Equal(0, len(collector.Diagnostics()), "excluded types are not scanned")
+}
+
+func TestScannerFilterInclude(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "included")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package included
+
+type Order struct {
+	Status   Status
+	Items    []*Item
+	Tags     Tags
+	Internal Internal
+}
+
+type Item struct {
+	Name string
+}
+
+type Tags map[string]string
+
+type Status int
+
+const (
+	Pending Status = iota
+	Shipped
+)
+
+type Internal struct {
+	Secret string
+}
+
+type Other struct {
+	Name string
+}
+
+type Color int
+
+const Red Color = 1
+`),
+	}, path)
+	require.Nil(err)
+	scanner.Filter, err = NewTypeFilter([]string{"Order"}, []string{"Internal"})
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	pkg := pkgs[0]
+
+	var structs []string
+	for _, s := range pkg.Structs {
+		structs = append(structs, s.Name)
+	}
+	require.Equal([]string{"Item", "Order"}, structs, "referenced structs are kept, the rest are not")
+	assertStruct(t, pkg.Structs[1], "Order", "Status", "Items", "Tags", "Internal")
+
+	require.Equal(1, len(pkg.Enums), "enums of unrelated types are not kept")
+	require.Equal("Status", pkg.Enums[0].Name)
+	require.Equal([]string{"Pending", "Shipped"}, pkg.Enums[0].Values)
+
+	require.Equal(1, len(pkg.Aliases))
+	require.NotNil(pkg.Aliases[path+".Tags"])
+}
+
+func TestScannerFollow(t *testing.T) {
+	require := require.New(t)
+
+	a, b := projectPath("fixtures/overlay/a"), projectPath("fixtures/overlay/b")
+	overlay := map[string][]byte{
+		filepath.Join(a, "a.go"): []byte(`package a
+
+import (
+	"net/url"
+
+	"github.com/src-d/proteus/fixtures/overlay/b"
+)
+
+type A struct {
+	B   b.B
+	URL url.URL
+}
+`),
+		filepath.Join(b, "b.go"): []byte(`package b
+
+import "github.com/src-d/proteus/fixtures/subpkg"
+
+type Points map[string]subpkg.Point
+
+type B struct {
+	Points Points
+}
+`),
+	}
+
+	scanner, err := NewWithOverlay(overlay, a)
+	require.Nil(err)
+
+	scanner.Follow = []string{project + "/fixtures/"}
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(3, len(pkgs), "with follow")
+	require.Equal(importPath("fixtures/overlay/a"), pkgs[0].Path)
+	require.Equal(importPath("fixtures/overlay/b"), pkgs[1].Path)
+	require.Equal(importPath("fixtures/subpkg"), pkgs[2].Path)
+	assertStruct(t, pkgs[2].Structs[0], "Point", "X", "Y")
+
+	scanner, err = New(projectPath("fixtures"))
+	require.Nil(err)
+	scanner.Follow = []string{"net"}
+	pkgs, err = scanner.Scan()
+	require.Nil(err)
+	require.Equal(2, len(pkgs), "with follow of std package")
+	require.Equal("net/url", pkgs[1].Path)
+}
+
+func TestScannerWithOverlay(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(os.TempDir(), "proteus-overlay", "foo")
+	scanner, err := NewWithOverlay(map[string][]byte{
+		filepath.Join(path, "foo.go"): []byte(`package foo
+
+import "time"
+
+type Foo struct {
+	Name string
+	At   time.Time
+}
+`),
+		filepath.Join(path, "bar.go"): []byte(`package foo
+
+type Bar struct {
+	Foo *Foo
+}
+`),
+	}, path)
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(1, len(pkgs), "scan packages")
+
+	pkg := pkgs[0]
+	require.Equal("foo", pkg.Name)
+	require.Equal(2, len(pkg.Structs), "pkg")
+	assertStruct(t, pkg.Structs[0], "Bar", "Foo")
+	assertStruct(t, pkg.Structs[1], "Foo", "Name", "At")
+}
+
+func TestScannerWithOverlayReplacingFiles(t *testing.T) {
+	require := require.New(t)
+
+	scanner, err := NewWithOverlay(map[string][]byte{
+		projectPath("fixtures/subpkg/foo.go"): []byte(`package subpkg
+
+type Point struct {
+	X, Y, Z int
+}
+`),
+	}, projectPath("fixtures/subpkg"))
+	require.Nil(err)
+
+	pkgs, err := scanner.Scan()
+	require.Nil(err)
+	require.Equal(1, len(pkgs), "scan packages")
+	assertStruct(t, pkgs[0].Structs[0], "Point", "X", "Y", "Z")
+}
+
+func TestNewWithOverlayNotDir(t *testing.T) {
+	_, err := NewWithOverlay(map[string][]byte{
+		"/proteus/foo/foo.go": []byte("package foo"),
+	}, "/proteus/bar")
+	require.NotNil(t, err)
+}
+
+func TestOverlayIsDir(t *testing.T) {
+	require := require.New(t)
+
+	wd, err := os.Getwd()
+	require.Nil(err)
+
+	o := newOverlay(map[string][]byte{
+		"/proteus/foo/bar/baz.go": []byte("package bar"),
+		"qux/qux.go":              []byte("package qux"),
+	})
+
+	require.True(o.isDir("/proteus/foo/bar"))
+	require.True(o.isDir("/proteus/foo"), "every ancestor is a directory")
+	require.True(o.isDir("/proteus/"))
+	require.False(o.isDir("/proteus/foo/bar/baz.go"))
+	require.False(o.isDir("/proteus/fo"))
+
+	require.True(o.isDir("qux"))
+	require.True(o.isDir(filepath.Join(wd, "qux")), "relative and absolute paths are the same")
+	require.NotNil(o.source(filepath.Join(wd, "qux", "qux.go")))
+	require.NotNil(o.source("./qux/../qux/qux.go"))
+}
+
 func assertStruct(t *testing.T, s *Struct, name string, fields ...string) {
 	require.Equal(
 		t,
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/src-d/proteus/report"
+)
+
+// registerSuppressions adds to the suppressor all the ignore directives
+// found in the comments of the type declarations, struct fields and
+// functions of the given files. A directive on a type applies to the whole
+// declaration, including its fields.
+func registerSuppressions(s report.Suppressor, fset *token.FileSet, files []*ast.File) {
+	register := func(node ast.Node, comments ...*ast.CommentGroup) {
+		for _, cg := range comments {
+			if cg == nil {
+				continue
+			}
+
+			for _, c := range cg.List {
+				codes, ok := report.ParseIgnoreDirective(c.Text)
+				if !ok || len(codes) == 0 {
+					continue
+				}
+
+				s.Suppress(&report.Suppression{
+					Pos:   fset.Position(c.Pos()),
+					Start: fset.Position(node.Pos()),
+					End:   fset.Position(node.End()),
+					Codes: codes,
+				})
+			}
+		}
+	}
+
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.GenDecl:
+				if n.Tok != token.TYPE {
+					return false
+				}
+
+				for _, spec := range n.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if len(n.Specs) == 1 {
+						register(n, n.Doc, ts.Doc, ts.Comment)
+					} else {
+						register(ts, ts.Doc, ts.Comment)
+					}
+				}
+			case *ast.Field:
+				register(n, n.Doc, n.Comment)
+			case *ast.FuncDecl:
+				register(n, n.Doc)
+				return false
+			}
+			return true
+		})
+	}
+}
@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -18,3 +19,17 @@ func findProtoTags(tag string) []string {
 	}
 	return tags
 }
+
+// fieldNumber returns the number given as the first of the given proto
+// tags, or zero if there is none.
+func fieldNumber(tags []string) int {
+	if len(tags) == 0 {
+		return 0
+	}
+
+	n, err := strconv.Atoi(tags[0])
+	if err != nil {
+		return 0
+	}
+	return n
+}